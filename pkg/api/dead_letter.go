@@ -0,0 +1,322 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/TTraveller7/invokerlib/pkg/conf"
+	"github.com/TTraveller7/invokerlib/pkg/consts"
+	"github.com/TTraveller7/invokerlib/pkg/utils"
+)
+
+// inspectDeadLetter returns dead letter records of a processor that have not been redriven.
+func inspectDeadLetter(req *InvokerRequest) (*InvokerResponse, error) {
+	logs.Printf("monitor inspect dead letter starts")
+	p := &DeadLetterParams{}
+	if err := UnmarshalParams(req.Params, p); err != nil {
+		err = fmt.Errorf("unmarshal params failed: %v", err)
+		logs.Printf("%v", err)
+		return nil, err
+	}
+	limit := p.Limit
+	if limit <= 0 {
+		limit = consts.DefaultCatLimit
+	}
+
+	pc, dlc, err := deadLetterConfigOf(p.ProcessorName)
+	if err != nil {
+		logs.Printf("%v", err)
+		return nil, err
+	}
+	dlq, err := openDeadLetter(pc, dlc)
+	if err != nil {
+		logs.Printf("%v", err)
+		return nil, err
+	}
+	defer dlq.close()
+
+	entries := make([]DeadLetterEntry, 0)
+	for _, partition := range dlq.partitions {
+		if len(entries) >= limit {
+			break
+		}
+		err := dlq.read(partition, limit-len(entries), func(msg *sarama.ConsumerMessage) error {
+			entry := DeadLetterEntry{
+				Partition: msg.Partition,
+				Offset:    msg.Offset,
+				Key:       string(msg.Key),
+				Val:       string(msg.Value),
+				Headers:   make(map[string]string, len(msg.Headers)),
+			}
+			for _, h := range msg.Headers {
+				entry.Headers[string(h.Key)] = string(h.Value)
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+		if err != nil {
+			err = fmt.Errorf("read dead letter partition %v failed: %v", partition, err)
+			logs.Printf("%v", err)
+			return nil, err
+		}
+	}
+
+	msgBytes, err := json.Marshal(entries)
+	if err != nil {
+		err = fmt.Errorf("marshal dead letter entries failed: %v", err)
+		logs.Printf("%v", err)
+		return nil, err
+	}
+	resp := successResponse()
+	resp.Message = string(msgBytes)
+	logs.Printf("monitor inspect dead letter finished")
+	return resp, nil
+}
+
+// redriveDeadLetter sends dead letter records of a processor back to their source topics. Redriven records are
+// tracked with a consumer group, so a record is redriven only once.
+func redriveDeadLetter(req *InvokerRequest) (*InvokerResponse, error) {
+	logs.Printf("monitor redrive dead letter starts")
+	if lockSuccess := monitorMut.TryLock(); !lockSuccess {
+		err := fmt.Errorf("fail to lock monitor: another client holds the lock")
+		logs.Printf("%v", err)
+		return nil, err
+	}
+	defer monitorMut.Unlock()
+
+	p := &DeadLetterParams{}
+	if err := UnmarshalParams(req.Params, p); err != nil {
+		err = fmt.Errorf("unmarshal params failed: %v", err)
+		logs.Printf("%v", err)
+		return nil, err
+	}
+
+	pc, dlc, err := deadLetterConfigOf(p.ProcessorName)
+	if err != nil {
+		logs.Printf("%v", err)
+		return nil, err
+	}
+	dlq, err := openDeadLetter(pc, dlc)
+	if err != nil {
+		logs.Printf("%v", err)
+		return nil, err
+	}
+	defer dlq.close()
+
+	// source topic -> address
+	sourceAddresses := make(map[string]string, 0)
+	for _, inputProcessor := range pc.InputProcessors {
+		sourceAddresses[inputProcessor] = rootConfig.GlobalKafkaConfig.Address
+	}
+	for _, kc := range pc.InputKafkaConfigs {
+		sourceAddresses[kc.Topic] = kc.Address
+	}
+
+	producerConfig := sarama.NewConfig()
+	producerConfig.Producer.Return.Successes = true
+	addrToProducer := make(map[string]sarama.SyncProducer, 0)
+	defer func() {
+		for _, producer := range addrToProducer {
+			producer.Close()
+		}
+	}()
+
+	count := 0
+	for _, partition := range dlq.partitions {
+		err := dlq.read(partition, 0, func(msg *sarama.ConsumerMessage) error {
+			sourceTopic := ""
+			headers := make([]sarama.RecordHeader, 0, len(msg.Headers))
+			for _, h := range msg.Headers {
+				key := string(h.Key)
+				if key == consts.DeadLetterHeaderSourceTopic {
+					sourceTopic = string(h.Value)
+				}
+				if strings.HasPrefix(key, consts.DeadLetterHeaderPrefix) {
+					continue
+				}
+				headers = append(headers, *h)
+			}
+			addr, exists := sourceAddresses[sourceTopic]
+			if !exists {
+				return fmt.Errorf("source topic %s of offset %v is not an input of processor %s",
+					sourceTopic, msg.Offset, pc.Name)
+			}
+
+			producer, exists := addrToProducer[addr]
+			if !exists {
+				producer, err = sarama.NewSyncProducer([]string{addr}, producerConfig)
+				if err != nil {
+					return fmt.Errorf("create producer failed: %v", err)
+				}
+				addrToProducer[addr] = producer
+			}
+
+			redriveMsg := &sarama.ProducerMessage{
+				Topic:     sourceTopic,
+				Value:     sarama.ByteEncoder(msg.Value),
+				Headers:   headers,
+				Timestamp: msg.Timestamp,
+			}
+			if msg.Key != nil {
+				redriveMsg.Key = sarama.ByteEncoder(msg.Key)
+			}
+			if _, _, err := producer.SendMessage(redriveMsg); err != nil {
+				return fmt.Errorf("send message failed: %v", err)
+			}
+			dlq.markRedriven(msg)
+			count++
+			return nil
+		})
+		if err != nil {
+			// records redriven before the failure are committed on close
+			err = fmt.Errorf("redrive dead letter partition %v failed after %v records redriven: %v",
+				partition, count, err)
+			logs.Printf("%v", err)
+			return nil, err
+		}
+	}
+
+	resp := successResponse()
+	resp.Message = fmt.Sprintf("%v records redriven", count)
+	logs.Printf("monitor redrive dead letter finished: count=%v", count)
+	return resp, nil
+}
+
+func deadLetterConfigOf(processorName string) (*conf.ProcessorConfig, *conf.KafkaConfig, error) {
+	if rootConfig.GlobalKafkaConfig == nil {
+		return nil, nil, fmt.Errorf("root config is not loaded")
+	}
+	for _, pc := range rootConfig.ProcessorConfigs {
+		if pc.Name != processorName {
+			continue
+		}
+		dlc := pc.DeadLetterKafkaConfig(rootConfig.GlobalKafkaConfig.Address)
+		if dlc == nil {
+			return nil, nil, fmt.Errorf("processor %s does not enable dead letter", processorName)
+		}
+		return pc, dlc, nil
+	}
+	return nil, nil, fmt.Errorf("processor with name %s does not exist", processorName)
+}
+
+type deadLetterTopic struct {
+	topic      string
+	client     sarama.Client
+	consumer   sarama.Consumer
+	om         sarama.OffsetManager
+	poms       map[int32]sarama.PartitionOffsetManager
+	partitions []int32
+}
+
+func openDeadLetter(pc *conf.ProcessorConfig, dlc *conf.KafkaConfig) (*deadLetterTopic, error) {
+	config := sarama.NewConfig()
+	config.Version = sarama.V2_0_0_0
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	config.Consumer.IsolationLevel = sarama.ReadCommitted
+
+	client, err := sarama.NewClient([]string{dlc.Address}, config)
+	if err != nil {
+		return nil, fmt.Errorf("create kafka client failed: %v", err)
+	}
+	d := &deadLetterTopic{
+		topic:  dlc.Topic,
+		client: client,
+		poms:   make(map[int32]sarama.PartitionOffsetManager, 0),
+	}
+	d.partitions, err = client.Partitions(dlc.Topic)
+	if err != nil {
+		d.close()
+		return nil, fmt.Errorf("get partitions of topic %s failed: %v", dlc.Topic, err)
+	}
+	d.consumer, err = sarama.NewConsumerFromClient(client)
+	if err != nil {
+		d.close()
+		return nil, fmt.Errorf("create consumer failed: %v", err)
+	}
+	d.om, err = sarama.NewOffsetManagerFromClient(dlc.Topic+consts.DeadLetterRedriveGroupSuffix, client)
+	if err != nil {
+		d.close()
+		return nil, fmt.Errorf("create offset manager failed: %v", err)
+	}
+	for _, partition := range d.partitions {
+		pom, err := d.om.ManagePartition(dlc.Topic, partition)
+		if err != nil {
+			d.close()
+			return nil, fmt.Errorf("manage partition %v failed: %v", partition, err)
+		}
+		d.poms[partition] = pom
+	}
+	return d, nil
+}
+
+// read calls fn on records of a partition that have not been redriven, until the partition is caught up with the
+// newest offset at the time of the call or limit records are read. A limit of 0 means no limit.
+func (d *deadLetterTopic) read(partition int32, limit int, fn func(msg *sarama.ConsumerMessage) error) error {
+	oldest, err := d.client.GetOffset(d.topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return err
+	}
+	newest, err := d.client.GetOffset(d.topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return err
+	}
+	next, _ := d.poms[partition].NextOffset()
+	if next < oldest {
+		next = oldest
+	}
+	if next >= newest {
+		return nil
+	}
+
+	pc, err := d.consumer.ConsumePartition(d.topic, partition, next)
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+
+	// with exactly once, the last offset is a transaction marker, which is never delivered
+	catchUp := utils.NewCatchUp(newest, consts.CatchUpIdleMs*time.Millisecond,
+		consts.CatchUpFirstRecordTimeoutMs*time.Millisecond)
+	ticker := time.NewTicker(consts.CatchUpCheckIntervalMs * time.Millisecond)
+	defer ticker.Stop()
+	count := 0
+	for {
+		select {
+		case msg := <-pc.Messages():
+			if err := fn(msg); err != nil {
+				return err
+			}
+			count++
+			if catchUp.Consumed(msg.Offset) || (limit > 0 && count >= limit) {
+				return nil
+			}
+		case err := <-pc.Errors():
+			return err
+		case <-ticker.C:
+			if catchUp.Idle() {
+				return nil
+			}
+		}
+	}
+}
+
+func (d *deadLetterTopic) markRedriven(msg *sarama.ConsumerMessage) {
+	d.poms[msg.Partition].MarkOffset(msg.Offset+1, "")
+}
+
+func (d *deadLetterTopic) close() {
+	for _, pom := range d.poms {
+		pom.Close()
+	}
+	if d.om != nil {
+		// commits marked offsets
+		d.om.Close()
+	}
+	if d.consumer != nil {
+		d.consumer.Close()
+	}
+	d.client.Close()
+}
@@ -24,6 +24,11 @@ var MonitorCommands = struct {
 	LoadProcessorEndpoints string
 	InitializeProcessors   string
 	RunProcessors          string
+	PauseProcessors        string
+	ResumeProcessors       string
+	StopProcessors         string
+	InspectDeadLetter      string
+	RedriveDeadLetter      string
 	Load                   string
 	CatProcessor           string
 }{
@@ -32,6 +37,11 @@ var MonitorCommands = struct {
 	LoadProcessorEndpoints: "loadProcessorEndpoints",
 	InitializeProcessors:   "initializeProcessors",
 	RunProcessors:          "runProcessors",
+	PauseProcessors:        "pauseProcessors",
+	ResumeProcessors:       "resumeProcessors",
+	StopProcessors:         "stopProcessors",
+	InspectDeadLetter:      "inspectDeadLetter",
+	RedriveDeadLetter:      "redriveDeadLetter",
 	Load:                   "load",
 	CatProcessor:           "catProcessor",
 }
@@ -115,6 +125,16 @@ func monitorHandle(req *InvokerRequest) (*InvokerResponse, error) {
 		return initializeProcessors()
 	case MonitorCommands.RunProcessors:
 		return runProcessors()
+	case MonitorCommands.PauseProcessors:
+		return pauseProcessors(req)
+	case MonitorCommands.ResumeProcessors:
+		return resumeProcessors(req)
+	case MonitorCommands.StopProcessors:
+		return stopProcessors()
+	case MonitorCommands.InspectDeadLetter:
+		return inspectDeadLetter(req)
+	case MonitorCommands.RedriveDeadLetter:
+		return redriveDeadLetter(req)
 	case MonitorCommands.Load:
 		return load(req)
 	case MonitorCommands.CatProcessor:
@@ -239,6 +259,79 @@ func createTopics() (*InvokerResponse, error) {
 	}
 	logs.Printf("finish creating interim topics for processors")
 
+	// create dead letter topics for processors
+	logs.Printf("start to create dead letter topics for processors")
+	for _, pc := range rootConfig.ProcessorConfigs {
+		dlc := pc.DeadLetterKafkaConfig(kafkaAddr)
+		if dlc == nil || dlc.Address != kafkaAddr {
+			// dead letter topics on other clusters are not managed by monitor
+			continue
+		}
+		numOfPartitions := pc.OutputConfig.DeadLetter.Partitions
+		if numOfPartitions == 0 {
+			numOfPartitions = 1
+		}
+		err := tryCreateTopic(dlc.Topic, numOfPartitions)
+		if err != nil {
+			err = fmt.Errorf("try create topic failed: %v", err)
+			logs.Printf("%v", err)
+			if _, err := removeTopics(); err != nil {
+				logs.Printf("remove topics failed: %v", err)
+				return nil, err
+			} else {
+				return nil, err
+			}
+		}
+
+		interimTopics = append(interimTopics, &conf.InternalKafkaConfig{
+			Address:    kafkaAddr,
+			Topic:      dlc.Topic,
+			Partitions: numOfPartitions,
+		})
+	}
+	logs.Printf("finish creating dead letter topics for processors")
+
+	// create changelog topics for processors
+	logs.Printf("start to create changelog topics for processors")
+	for _, pc := range rootConfig.ProcessorConfigs {
+		clc := pc.ChangelogKafkaConfig(kafkaAddr)
+		if clc == nil {
+			continue
+		}
+		numOfPartitions := pc.StateChangelog.Partitions
+		if numOfPartitions == 0 {
+			// changelog partitions line up with input partitions
+			n, err := inputPartitions(pc, kafkaAddr)
+			if err != nil {
+				err = fmt.Errorf("get input partitions of processor %s failed: %v", pc.Name, err)
+				logs.Printf("%v", err)
+				if _, err := removeTopics(); err != nil {
+					logs.Printf("remove topics failed: %v", err)
+				}
+				return nil, err
+			}
+			numOfPartitions = n
+		}
+		err := tryCreateCompactedTopic(clc.Topic, numOfPartitions)
+		if err != nil {
+			err = fmt.Errorf("try create topic failed: %v", err)
+			logs.Printf("%v", err)
+			if _, err := removeTopics(); err != nil {
+				logs.Printf("remove topics failed: %v", err)
+				return nil, err
+			} else {
+				return nil, err
+			}
+		}
+
+		interimTopics = append(interimTopics, &conf.InternalKafkaConfig{
+			Address:    kafkaAddr,
+			Topic:      clc.Topic,
+			Partitions: numOfPartitions,
+		})
+	}
+	logs.Printf("finish creating changelog topics for processors")
+
 	for _, pc := range rootConfig.ProcessorConfigs {
 		meta := &ProcessorMetadata{
 			Name: pc.Name,
@@ -251,7 +344,40 @@ func createTopics() (*InvokerResponse, error) {
 	return successResponse(), nil
 }
 
+// inputPartitions returns the number of partitions of the input topic of a processor with one input, which must be
+// on the global Kafka cluster.
+func inputPartitions(pc *conf.ProcessorConfig, kafkaAddr string) (int, error) {
+	var topic string
+	if len(pc.InputProcessors) > 0 {
+		topic = pc.InputProcessors[0]
+	} else if len(pc.InputKafkaConfigs) > 0 && pc.InputKafkaConfigs[0].Address == kafkaAddr {
+		topic = pc.InputKafkaConfigs[0].Topic
+	} else {
+		return 0, fmt.Errorf("input topic is not on the global kafka cluster, so changelog partitions must be set")
+	}
+	metadata, err := adminClient.DescribeTopics([]string{topic})
+	if err != nil {
+		return 0, fmt.Errorf("describe topic %s failed: %v", topic, err)
+	}
+	if len(metadata) == 0 || metadata[0].Err != sarama.ErrNoError {
+		return 0, fmt.Errorf("topic %s is not found", topic)
+	}
+	return len(metadata[0].Partitions), nil
+}
+
 func tryCreateTopic(topic string, partitions int) error {
+	return tryCreateTopicWithConfig(topic, partitions, nil)
+}
+
+// tryCreateCompactedTopic creates a topic that keeps the last record of each key.
+func tryCreateCompactedTopic(topic string, partitions int) error {
+	cleanupPolicy := "compact"
+	return tryCreateTopicWithConfig(topic, partitions, map[string]*string{
+		"cleanup.policy": &cleanupPolicy,
+	})
+}
+
+func tryCreateTopicWithConfig(topic string, partitions int, configEntries map[string]*string) error {
 	if adminClient == nil {
 		err := fmt.Errorf("admin client must be initialized before calling tryCreateTopic")
 		logs.Printf("%v", err)
@@ -273,6 +399,7 @@ func tryCreateTopic(topic string, partitions int) error {
 	err = adminClient.CreateTopic(topic, &sarama.TopicDetail{
 		NumPartitions:     int32(partitions),
 		ReplicationFactor: 1,
+		ConfigEntries:     configEntries,
 	}, false)
 	if err != nil {
 		err = fmt.Errorf("create topic failed: %v", err)
@@ -403,6 +530,156 @@ func runProcessors() (*InvokerResponse, error) {
 	return successResponse(), nil
 }
 
+func pauseProcessors(req *InvokerRequest) (*InvokerResponse, error) {
+	logs.Printf("monitor pause processors starts")
+	if lockSuccess := monitorMut.TryLock(); !lockSuccess {
+		err := fmt.Errorf("fail to lock monitor: another client holds the lock")
+		logs.Printf("%v", err)
+		return nil, err
+	}
+	defer monitorMut.Unlock()
+
+	p := &PauseProcessorsParams{}
+	if err := UnmarshalParams(req.Params, p); err != nil {
+		err = fmt.Errorf("unmarshal params failed: %v", err)
+		logs.Printf("%v", err)
+		return nil, err
+	}
+	selected, err := selectProcessorMetadata(p.ProcessorNames)
+	if err != nil {
+		logs.Printf("%v", err)
+		return nil, err
+	}
+
+	for _, metadata := range selected {
+		resp, err := metadata.Client.Pause()
+		if err != nil {
+			err = fmt.Errorf("processor %s pause failed: %v", metadata.Name, err)
+			logs.Printf("%v", err)
+			return nil, err
+		} else if resp.Code != ResponseCodes.Success {
+			err = fmt.Errorf("processor %s pause failed with resp: %+v", metadata.Name, resp)
+			logs.Printf("%v", err)
+			return nil, err
+		}
+		logs.Printf("processor %s pause finished with resp: %+v", metadata.Name, resp)
+	}
+
+	logs.Printf("monitor pause processors finished")
+	return successResponse(), nil
+}
+
+func resumeProcessors(req *InvokerRequest) (*InvokerResponse, error) {
+	logs.Printf("monitor resume processors starts")
+	if lockSuccess := monitorMut.TryLock(); !lockSuccess {
+		err := fmt.Errorf("fail to lock monitor: another client holds the lock")
+		logs.Printf("%v", err)
+		return nil, err
+	}
+	defer monitorMut.Unlock()
+
+	p := &PauseProcessorsParams{}
+	if err := UnmarshalParams(req.Params, p); err != nil {
+		err = fmt.Errorf("unmarshal params failed: %v", err)
+		logs.Printf("%v", err)
+		return nil, err
+	}
+	selected, err := selectProcessorMetadata(p.ProcessorNames)
+	if err != nil {
+		logs.Printf("%v", err)
+		return nil, err
+	}
+
+	for _, metadata := range selected {
+		resp, err := metadata.Client.Resume()
+		if err != nil {
+			err = fmt.Errorf("processor %s resume failed: %v", metadata.Name, err)
+			logs.Printf("%v", err)
+			return nil, err
+		} else if resp.Code != ResponseCodes.Success {
+			err = fmt.Errorf("processor %s resume failed with resp: %+v", metadata.Name, resp)
+			logs.Printf("%v", err)
+			return nil, err
+		}
+		logs.Printf("processor %s resume finished with resp: %+v", metadata.Name, resp)
+	}
+
+	logs.Printf("monitor resume processors finished")
+	return successResponse(), nil
+}
+
+// stopProcessors stops all processors in reverse topological order. A processor failing to stop does not
+// prevent the other processors from being stopped.
+func stopProcessors() (*InvokerResponse, error) {
+	logs.Printf("monitor stop processors starts")
+	if lockSuccess := monitorMut.TryLock(); !lockSuccess {
+		err := fmt.Errorf("fail to lock monitor: another client holds the lock")
+		logs.Printf("%v", err)
+		return nil, err
+	}
+	defer monitorMut.Unlock()
+
+	order, err := rootConfig.TopologicalOrder()
+	if err != nil {
+		err = fmt.Errorf("get topological order of processors failed: %v", err)
+		logs.Printf("%v", err)
+		return nil, err
+	}
+
+	failedProcessors := make([]string, 0)
+	for i := len(order) - 1; i >= 0; i-- {
+		metadata, exists := processorMetadata[order[i]]
+		if !exists || metadata.Client == nil {
+			logs.Printf("processor %s client is not initialized, skip stopping it", order[i])
+			continue
+		}
+		resp, err := metadata.Client.Exit()
+		if err != nil {
+			logs.Printf("processor %s exit failed: %v", metadata.Name, err)
+			failedProcessors = append(failedProcessors, metadata.Name)
+			continue
+		} else if resp.Code != ResponseCodes.Success {
+			logs.Printf("processor %s exit failed with resp: %+v", metadata.Name, resp)
+			failedProcessors = append(failedProcessors, metadata.Name)
+			continue
+		}
+		logs.Printf("processor %s exit finished with resp: %+v", metadata.Name, resp)
+	}
+	if len(failedProcessors) > 0 {
+		err := fmt.Errorf("processors %v failed to stop", failedProcessors)
+		logs.Printf("%v", err)
+		return nil, err
+	}
+
+	logs.Printf("monitor stop processors finished")
+	return successResponse(), nil
+}
+
+// selectProcessorMetadata returns the metadata of processors with the given names, or the metadata of
+// all processors if names is empty.
+func selectProcessorMetadata(names []string) ([]*ProcessorMetadata, error) {
+	selected := make([]*ProcessorMetadata, 0)
+	if len(names) == 0 {
+		for _, metadata := range processorMetadata {
+			selected = append(selected, metadata)
+		}
+	} else {
+		for _, name := range names {
+			metadata, exists := processorMetadata[name]
+			if !exists {
+				return nil, fmt.Errorf("processor with name %s does not exist", name)
+			}
+			selected = append(selected, metadata)
+		}
+	}
+	for _, metadata := range selected {
+		if metadata.Client == nil {
+			return nil, fmt.Errorf("processor %s client is not initialized", metadata.Name)
+		}
+	}
+	return selected, nil
+}
+
 func load(req *InvokerRequest) (*InvokerResponse, error) {
 	logs.Printf("monitor load starts")
 	if lockSuccess := monitorMut.TryLock(); !lockSuccess {
@@ -19,12 +19,16 @@ import (
 var ProcessorCommands = struct {
 	Initialize string
 	Run        string
+	Pause      string
+	Resume     string
 	Exit       string
 	Ping       string
 	Cat        string
 }{
 	Initialize: "initialize",
 	Run:        "run",
+	Pause:      "pause",
+	Resume:     "resume",
 	Exit:       "exit",
 	Ping:       "ping",
 	Cat:        "cat",
@@ -79,6 +83,12 @@ func ProcessorHandle(w http.ResponseWriter, r *http.Request, pc *models.Processo
 		resp.Message = "pong"
 	case ProcessorCommands.Run:
 		resp, handleErr = handleRun()
+	case ProcessorCommands.Pause:
+		resp, handleErr = handlePause()
+	case ProcessorCommands.Resume:
+		resp, handleErr = handleResume()
+	case ProcessorCommands.Exit:
+		resp, handleErr = handleExit()
 	case ProcessorCommands.Cat:
 		resp, handleErr = handleCat()
 	default:
@@ -121,6 +131,39 @@ func handleRun() (*InvokerResponse, error) {
 	return successResponse(), nil
 }
 
+func handlePause() (*InvokerResponse, error) {
+	logs.Printf("handle pause starts")
+	if err := core.Pause(); err != nil {
+		err = fmt.Errorf("Pause failed: %v", err)
+		logs.Printf("%v", err)
+		return nil, err
+	}
+	logs.Printf("handle pause finished")
+	return successResponse(), nil
+}
+
+func handleResume() (*InvokerResponse, error) {
+	logs.Printf("handle resume starts")
+	if err := core.Resume(); err != nil {
+		err = fmt.Errorf("Resume failed: %v", err)
+		logs.Printf("%v", err)
+		return nil, err
+	}
+	logs.Printf("handle resume finished")
+	return successResponse(), nil
+}
+
+func handleExit() (*InvokerResponse, error) {
+	logs.Printf("handle exit starts")
+	if err := core.Exit(); err != nil {
+		err = fmt.Errorf("Exit failed: %v", err)
+		logs.Printf("%v", err)
+		return nil, err
+	}
+	logs.Printf("handle exit finished")
+	return successResponse(), nil
+}
+
 func handleCat() (*InvokerResponse, error) {
 	logs.Printf("handle cat starts")
 	res, err := cat(context.Background())
@@ -147,14 +190,27 @@ func cat(ctx context.Context) (ProcessorCatResult, error) {
 	resp := make(map[string][]StateStoreEntry, 0)
 	stateStores := state.StateStores()
 	for name, stateStore := range stateStores {
-		keys, err := stateStore.Keys(ctx, limit)
-		if err != nil {
+		keys, err := state.ScanKeys(ctx, stateStore, "", limit)
+		if err == state.ErrNotImplemented {
+			logs.Printf("state store %s cannot be scanned", name)
+			continue
+		} else if err != nil {
 			return nil, err
 		}
 		entries := make([]StateStoreEntry, 0)
 		for _, key := range keys {
 			val, err := stateStore.Get(ctx, key)
-			if err != nil {
+			if err == consts.ErrStateStoreWrongType {
+				// lists and sets of stores with native collections
+				val, err = catCollection(ctx, stateStore, key, limit)
+			}
+			if err == consts.ErrStateStoreKeyNotExist {
+				// the key expires or is deleted after the scan
+				continue
+			} else if err == consts.ErrStateStoreWrongType {
+				logs.Printf("key %s of state store %s is neither a value, a list nor a set", key, name)
+				continue
+			} else if err != nil {
 				return nil, err
 			}
 			entries = append(entries, StateStoreEntry{
@@ -166,3 +222,26 @@ func cat(ctx context.Context) (ProcessorCatResult, error) {
 	}
 	return resp, nil
 }
+
+// catCollection returns up to limit elements of the list or the set at key as a json array of strings.
+func catCollection(ctx context.Context, s state.StateStore, key string, limit int) ([]byte, error) {
+	cs, ok := state.AsCollectionStateStore(s)
+	if !ok {
+		return nil, consts.ErrStateStoreWrongType
+	}
+	elements, err := cs.ListRange(ctx, key, 0, limit-1)
+	if err == consts.ErrStateStoreWrongType {
+		elements, err = cs.SetMembers(ctx, key)
+		if len(elements) > limit {
+			elements = elements[:limit]
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	strs := make([]string, 0, len(elements))
+	for _, e := range elements {
+		strs = append(strs, string(e))
+	}
+	return json.Marshal(strs)
+}
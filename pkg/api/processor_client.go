@@ -54,6 +54,30 @@ func (pc *ProcessorClient) Run() (*InvokerResponse, error) {
 	return resp, nil
 }
 
+func (pc *ProcessorClient) Pause() (*InvokerResponse, error) {
+	resp, err := pc.SendCommand(NewInvokerRequestParams(), ProcessorCommands.Pause)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (pc *ProcessorClient) Resume() (*InvokerResponse, error) {
+	resp, err := pc.SendCommand(NewInvokerRequestParams(), ProcessorCommands.Resume)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (pc *ProcessorClient) Exit() (*InvokerResponse, error) {
+	resp, err := pc.SendCommand(NewInvokerRequestParams(), ProcessorCommands.Exit)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
 func (pc *ProcessorClient) Cat() (*InvokerResponse, error) {
 	resp, err := pc.SendCommand(NewInvokerRequestParams(), ProcessorCommands.Cat)
 	if err != nil {
@@ -44,3 +44,16 @@ type LoadParams struct {
 type CatProcessorParams struct {
 	ProcessorName string `json:"processorName"`
 }
+
+// PauseProcessorsParams selects the processors to pause or resume. If ProcessorNames is empty,
+// all processors are selected.
+type PauseProcessorsParams struct {
+	ProcessorNames []string `json:"processorNames"`
+}
+
+type DeadLetterParams struct {
+	ProcessorName string `json:"processorName"`
+
+	// Limit is the maximum number of dead letter records to inspect. Defaults to DefaultCatLimit.
+	Limit int `json:"limit"`
+}
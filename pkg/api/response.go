@@ -39,3 +39,11 @@ func failureResponse(err error) *InvokerResponse {
 		Message:  err.Error(),
 	}
 }
+
+type DeadLetterEntry struct {
+	Partition int32             `json:"partition"`
+	Offset    int64             `json:"offset"`
+	Key       string            `json:"key"`
+	Val       string            `json:"val"`
+	Headers   map[string]string `json:"headers"`
+}
@@ -2,6 +2,7 @@ package conf
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/TTraveller7/invokerlib/pkg/consts"
 )
@@ -33,14 +34,12 @@ type NamedKafkaConfig struct {
 // 3. All interim topics are stored on one single Kafka cluster.
 
 // Proposals:
-// 1. Topological ordering?
-// 2. Monitor healthchecks
-// 3. Local state store health check: We should make sure that the local state store always has enough size
+// 1. Monitor healthchecks
+// 2. Local state store health check: We should make sure that the local state store always has enough size
 // so that keys are not evicted automatically
-// 4. upload file
-// 5. state store commit log and check pointing
-// 6. automatic # worker and partition adjustment
-// 7. cat needs a limit - works like head in this way
+// 3. upload file
+// 4. automatic # worker and partition adjustment
+// 5. cat needs a limit - works like head in this way
 
 type ProcessorConfig struct {
 	// ParentDirectory is the parent directory that stores user-defined go files.
@@ -63,14 +62,121 @@ type ProcessorConfig struct {
 	NumOfWorker int `yaml:"numOfWorker"`
 
 	// InputProcessors and InputKafkaConfigs define the source of a processor's input. Either InputProcessor
-	// or InputKafkaConfig must be not empty. If both are specified, InputKafkaConfig will be used.
+	// or InputKafkaConfig must be not empty. Join processors may use both, and their inputs are ordered with
+	// InputProcessors before InputKafkaConfigs.
 	InputProcessors   []string       `yaml:"inputProcessors"`
 	InputKafkaConfigs []*KafkaConfig `yaml:"inputKafkaConfigs"`
 
 	// OutputConfig defines the output of a processor's input. OutputConfig must be specified in a config.
 	OutputConfig *OutputConfig `yaml:"outputConfig"`
 
-	WindowSize int `yaml:"windowSize"`
+	// WindowType is one of tumbling, hopping, sliding, session and interval. Defaults to tumbling.
+	//  - tumbling: records are joined in fixed windows of WindowSize seconds.
+	//  - hopping: windows of WindowSize seconds start every WindowSlide seconds, so a record belongs to
+	//    WindowSize/WindowSlide windows.
+	//  - sliding: records are joined if their timestamps are at most WindowSize seconds apart. Only inner join is
+	//    supported.
+	//  - session: records with the same join key are joined in a session, which ends when no record arrives
+	//    within SessionGap seconds.
+	//  - interval: a record of the first input is joined with records of other inputs whose timestamps are
+	//    within [ts-IntervalLower, ts+IntervalUpper] of it. Only inner join is supported.
+	// Aggregate processors use the same windows, except sliding and interval, and aggregate records by their keys.
+	WindowType    string `yaml:"windowType"`
+	WindowSize    int    `yaml:"windowSize"`
+	WindowSlide   int    `yaml:"windowSlide"`
+	SessionGap    int    `yaml:"sessionGap"`
+	IntervalLower int    `yaml:"intervalLower"`
+	IntervalUpper int    `yaml:"intervalUpper"`
+
+	// TimeMode defines how records are assigned to windows. With processingTime, records are assigned by the
+	// time they are processed. With eventTime, records are assigned by their Kafka message timestamps, and
+	// the watermark moves forward with the timestamps seen. Defaults to processingTime.
+	TimeMode string `yaml:"timeMode"`
+
+	// MaxOutOfOrderness is the number of seconds that a record timestamp may fall behind the largest timestamp
+	// seen. Only used in eventTime mode.
+	MaxOutOfOrderness int `yaml:"maxOutOfOrderness"`
+
+	// AllowedLateness is the number of seconds that a window is kept open after the watermark passes the
+	// window end. Records of a window that has been closed are dropped. Only used in eventTime mode.
+	AllowedLateness int `yaml:"allowedLateness"`
+
+	// CrossJoin makes a join processor join every pair of records in a window, instead of records with the same
+	// join key.
+	CrossJoin bool `yaml:"crossJoin"`
+
+	// TableInputs are the topics of inputs of a join processor that are tables. A table input is a compacted topic
+	// materialised into the state store by record key, where records with nil values delete their keys. If a join
+	// processor has table inputs, it must have exactly one other input, the stream, and each record of the stream
+	// is joined with the records of the tables under its join key instead of using windows. Tables are fully
+	// loaded before the stream is consumed. Only inner and left join types are supported, and a left join keeps
+	// stream records whose key is missing in a table.
+	TableInputs []string `yaml:"tableInputs"`
+
+	// JoinType is one of inner, left, right and full. With an outer join type, records without a match in a window
+	// are passed to the join callback with nil in place of the missing records when the window closes. Left keeps
+	// records of the first input, and right keeps records of the last input. Defaults to inner.
+	JoinType string `yaml:"joinType"`
+
+	// RetryPolicy defines how a record is retried before its failure counts as final. If not specified, a record
+	// is processed only once.
+	RetryPolicy *RetryPolicyConfig `yaml:"retryPolicy"`
+
+	// ExactlyOnce makes the offsets of consumed records and the records produced for them committed atomically in
+	// Kafka transactions. Only process processors support it, and all of their input and output topics must be
+	// on the global Kafka cluster. The producer mode is ignored, since records are batched by transactions.
+	ExactlyOnce bool `yaml:"exactlyOnce"`
+
+	// StateStore is the state store that join and aggregate processors buffer records in. It is the name of a
+	// redis or memcached config in GlobalStoreConfig, or freecache or bigcache for a cache local to the processor.
+	// Defaults to state-redis.
+	StateStore string `yaml:"stateStore"`
+
+	// StateRetention is the number of seconds that join and aggregate processors keep buffered records in the
+	// state store. Records are deleted once their pane closes, so the retention only bounds records that are
+	// left behind, and it must be longer than the time a pane stays open. Defaults to five panes plus
+	// MaxOutOfOrderness and AllowedLateness.
+	StateRetention int `yaml:"stateRetention"`
+
+	// StateChangelog backs StateStore, which must be a local cache, with a compacted changelog topic. Every write
+	// to the state store is appended to the changelog, and each worker restores the state store from the
+	// changelog partitions of the input partitions assigned to it. Only process processors with one input support
+	// a changelog.
+	StateChangelog *ChangelogConfig `yaml:"stateChangelog"`
+}
+
+type RetryPolicyConfig struct {
+	// MaxAttempts is the maximum number of attempts to process a record, including the first one.
+	MaxAttempts int `yaml:"maxAttempts"`
+
+	// InitialBackoffMs is the backoff in milliseconds before the first retry. The backoff is multiplied by
+	// Multiplier after each retry, and is capped by MaxBackoffMs if MaxBackoffMs is positive.
+	InitialBackoffMs int     `yaml:"initialBackoffMs"`
+	MaxBackoffMs     int     `yaml:"maxBackoffMs"`
+	Multiplier       float64 `yaml:"multiplier"`
+
+	// Jitter is the fraction of backoff that is randomized. It must be between 0 and 1.
+	Jitter float64 `yaml:"jitter"`
+
+	// AttemptTimeoutMs is the timeout in milliseconds of each attempt. It is applied to the context passed to
+	// the process callback. 0 means no timeout.
+	AttemptTimeoutMs int `yaml:"attemptTimeoutMs"`
+}
+
+func (rp *RetryPolicyConfig) Validate() error {
+	if rp.MaxAttempts < 0 {
+		return fmt.Errorf("maxAttempts must be greater than or equal to 0")
+	}
+	if rp.InitialBackoffMs < 0 || rp.MaxBackoffMs < 0 || rp.AttemptTimeoutMs < 0 {
+		return fmt.Errorf("backoff and timeout must be greater than or equal to 0")
+	}
+	if rp.Multiplier != 0 && rp.Multiplier < 1 {
+		return fmt.Errorf("multiplier must be greater than or equal to 1")
+	}
+	if rp.Jitter < 0 || rp.Jitter > 1 {
+		return fmt.Errorf("jitter must be between 0 and 1")
+	}
+	return nil
 }
 
 type OutputConfig struct {
@@ -83,6 +189,263 @@ type OutputConfig struct {
 	// OutputKafkaConfigs defines non-processor destinations. The name of a self-defined OutputKafkaConfig
 	// must not be the same as any of the processor names, and must be unique among all the OutputKafkaConfigs.
 	OutputKafkaConfigs []*NamedKafkaConfig `yaml:"outputKafkaConfigs"`
+
+	// DeadLetter defines where records that fail processing are sent. If not specified or not enabled, a record
+	// that fails processing stops the worker.
+	DeadLetter *DeadLetterConfig `yaml:"deadLetter"`
+
+	// Producer defines how records are produced to output topics. If not specified, records are produced
+	// synchronously one by one.
+	Producer *ProducerConfig `yaml:"producer"`
+
+	// Partitioners defines how records are assigned to partitions of each output. The key is the name of an
+	// output processor or an OutputKafkaConfig, or the name of the processor itself for the default output topic.
+	// Outputs without a partitioner use the hash partitioner with fnv1a.
+	Partitioners map[string]*PartitionerConfig `yaml:"partitioners"`
+}
+
+type PartitionerConfig struct {
+	// Type is one of hash, roundRobin, sticky and callback. With callback, records are assigned by the
+	// Partitioner in processor callbacks. Defaults to hash.
+	Type string `yaml:"type"`
+
+	// Hash is one of fnv1a, murmur2 and crc32. Only used by the hash partitioner. Use murmur2 to be co-partitioned
+	// with topics produced by the Java Kafka client, and crc32 with topics produced by librdkafka. Defaults to fnv1a.
+	Hash string `yaml:"hash"`
+}
+
+func (pc *PartitionerConfig) Validate() error {
+	switch pc.Type {
+	case "", consts.PartitionerTypeHash:
+	case consts.PartitionerTypeRoundRobin, consts.PartitionerTypeSticky, consts.PartitionerTypeCallback:
+		if pc.Hash != "" {
+			return fmt.Errorf("hash is only supported by hash partitioner")
+		}
+	default:
+		return fmt.Errorf("unrecognized partitioner type %s", pc.Type)
+	}
+	switch pc.Hash {
+	case "", consts.HashFNV1a, consts.HashMurmur2, consts.HashCRC32:
+	default:
+		return fmt.Errorf("unrecognized hash %s", pc.Hash)
+	}
+	return nil
+}
+
+type ProducerConfig struct {
+	// Mode is either sync or async. In async mode, records are sent in batches, and the offset of a consumed
+	// record is marked only after all records produced while processing it are acknowledged. Defaults to sync.
+	Mode string `yaml:"mode"`
+
+	// LingerMs and BatchSize define how long and how many records are batched before a batch is sent.
+	// Only used in async mode.
+	LingerMs  int `yaml:"lingerMs"`
+	BatchSize int `yaml:"batchSize"`
+
+	// Compression is one of none, gzip, snappy, lz4 and zstd. Defaults to none.
+	Compression string `yaml:"compression"`
+
+	// Acks is one of none, leader and all. Defaults to leader.
+	Acks string `yaml:"acks"`
+}
+
+func (pc *ProducerConfig) Validate() error {
+	switch pc.Mode {
+	case "", consts.ProducerModeSync, consts.ProducerModeAsync:
+	default:
+		return fmt.Errorf("unrecognized producer mode %s", pc.Mode)
+	}
+	if pc.LingerMs < 0 || pc.BatchSize < 0 {
+		return fmt.Errorf("lingerMs and batchSize must be greater than or equal to 0")
+	}
+	switch pc.Compression {
+	case "", "none", "gzip", "snappy", "lz4", "zstd":
+	default:
+		return fmt.Errorf("unrecognized compression %s", pc.Compression)
+	}
+	switch pc.Acks {
+	case "", "none", "leader", "all":
+	default:
+		return fmt.Errorf("unrecognized acks %s", pc.Acks)
+	}
+	return nil
+}
+
+type DeadLetterConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Topic is the dead letter topic. Defaults to <processor name>_dlq. If Address is empty, the topic is created on
+	// the global Kafka cluster with the number of partitions in Partitions, which defaults to 1.
+	Topic      string `yaml:"topic"`
+	Address    string `yaml:"address"`
+	Partitions int    `yaml:"partitions"`
+}
+
+type ChangelogConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Topic is the changelog topic, which is created on the global Kafka cluster with the number of partitions in
+	// Partitions. Defaults to <processor name>_changelog, and Partitions defaults to the number of partitions of
+	// the input topic, which it must not be less than.
+	//
+	// A write made while processing a record is sent to the changelog partition with the number of the input
+	// partition of the record, and a worker restores the changelog partitions of the input partitions it claims
+	// before consuming them. Keys of the state store should therefore belong to one input partition, such as the
+	// keys of records. Writes made outside of processing, such as in OnInit, are partitioned by key.
+	Topic      string `yaml:"topic"`
+	Partitions int    `yaml:"partitions"`
+}
+
+// ChangelogKafkaConfig returns the changelog topic of the state store of the processor, or nil if changelog is not
+// enabled.
+func (pc *ProcessorConfig) ChangelogKafkaConfig(globalKafkaAddress string) *KafkaConfig {
+	if pc.StateChangelog == nil || !pc.StateChangelog.Enabled {
+		return nil
+	}
+	kc := &KafkaConfig{
+		Address: globalKafkaAddress,
+		Topic:   pc.StateChangelog.Topic,
+	}
+	if kc.Topic == "" {
+		kc.Topic = pc.Name + consts.ChangelogTopicSuffix
+	}
+	return kc
+}
+
+// DeadLetterKafkaConfig returns the dead letter topic of the processor, or nil if dead letter is not enabled.
+func (pc *ProcessorConfig) DeadLetterKafkaConfig(globalKafkaAddress string) *KafkaConfig {
+	if pc.OutputConfig == nil || pc.OutputConfig.DeadLetter == nil || !pc.OutputConfig.DeadLetter.Enabled {
+		return nil
+	}
+	dl := pc.OutputConfig.DeadLetter
+	kc := &KafkaConfig{
+		Address: dl.Address,
+		Topic:   dl.Topic,
+	}
+	if kc.Address == "" {
+		kc.Address = globalKafkaAddress
+	}
+	if kc.Topic == "" {
+		kc.Topic = pc.Name + consts.DeadLetterTopicSuffix
+	}
+	return kc
+}
+
+func (pc *ProcessorConfig) validateWindow() error {
+	switch pc.WindowType {
+	case "", consts.WindowTypeTumbling:
+		if pc.WindowSize < consts.JoinMinWindowSize {
+			return fmt.Errorf("window size is smaller than minimum")
+		}
+	case consts.WindowTypeHopping:
+		if pc.WindowSlide < consts.JoinMinWindowSize {
+			return fmt.Errorf("window slide is smaller than minimum")
+		}
+		if pc.WindowSize < pc.WindowSlide || pc.WindowSize%pc.WindowSlide != 0 {
+			return fmt.Errorf("window size must be a multiple of window slide")
+		}
+	case consts.WindowTypeSliding:
+		if pc.WindowSize < consts.JoinMinWindowSize {
+			return fmt.Errorf("window size is smaller than minimum")
+		}
+		if pc.JoinType != "" && pc.JoinType != consts.JoinTypeInner {
+			return fmt.Errorf("sliding window only supports inner join")
+		}
+	case consts.WindowTypeSession:
+		if pc.SessionGap < consts.JoinMinWindowSize {
+			return fmt.Errorf("session gap is smaller than minimum")
+		}
+	case consts.WindowTypeInterval:
+		if pc.IntervalLower < 0 || pc.IntervalUpper < 0 {
+			return fmt.Errorf("interval bounds must be greater than or equal to 0")
+		}
+		if pc.JoinType != "" && pc.JoinType != consts.JoinTypeInner {
+			return fmt.Errorf("interval window only supports inner join")
+		}
+	default:
+		return fmt.Errorf("unrecognized window type %s", pc.WindowType)
+	}
+	return nil
+}
+
+func (pc *ProcessorConfig) validateTableInputs(inputTopics map[string]bool) error {
+	tables := make(map[string]bool, 0)
+	for _, topic := range pc.TableInputs {
+		if !inputTopics[topic] {
+			return fmt.Errorf("table %s is not an input", topic)
+		}
+		if tables[topic] {
+			return fmt.Errorf("table %s is specified more than once", topic)
+		}
+		tables[topic] = true
+	}
+	if len(inputTopics)-len(tables) != 1 {
+		return fmt.Errorf("a join with tables must have exactly one stream input")
+	}
+	switch pc.JoinType {
+	case "", consts.JoinTypeInner, consts.JoinTypeLeft:
+	default:
+		return fmt.Errorf("a join with tables only supports inner and left join")
+	}
+	return nil
+}
+
+func (pc *ProcessorConfig) validateTimeMode() error {
+	switch pc.TimeMode {
+	case "", consts.TimeModeProcessingTime, consts.TimeModeEventTime:
+	default:
+		return fmt.Errorf("unrecognized time mode %s", pc.TimeMode)
+	}
+	if pc.MaxOutOfOrderness < 0 {
+		return fmt.Errorf("MaxOutOfOrderness must be greater than or equal to 0")
+	}
+	if pc.AllowedLateness < 0 {
+		return fmt.Errorf("AllowedLateness must be greater than or equal to 0")
+	}
+	return nil
+}
+
+func (pc *ProcessorConfig) isTableInput(topic string) bool {
+	for _, table := range pc.TableInputs {
+		if table == topic {
+			return true
+		}
+	}
+	return false
+}
+
+func (pc *ProcessorConfig) stateStoreName() string {
+	if pc.StateStore == "" {
+		return consts.DefaultStateStore
+	}
+	return pc.StateStore
+}
+
+// validateExactlyOnce checks that all records of a transaction and the consumer offsets are on the same cluster.
+func (pc *ProcessorConfig) validateExactlyOnce(gkc *GlobalKafkaConfig) error {
+	if pc.Type != consts.ProcessorTypeProcess {
+		return fmt.Errorf("only processor with type=process supports exactly once")
+	}
+	if gkc == nil {
+		return fmt.Errorf("global kafka config is missing")
+	}
+	for _, kc := range pc.InputKafkaConfigs {
+		if kc.Address != gkc.Address {
+			return fmt.Errorf("input topic %s is not on the global kafka cluster", kc.Topic)
+		}
+	}
+	for _, okc := range pc.OutputConfig.OutputKafkaConfigs {
+		if okc.Address != gkc.Address {
+			return fmt.Errorf("output topic %s is not on the global kafka cluster", okc.Topic)
+		}
+	}
+	if dlc := pc.DeadLetterKafkaConfig(gkc.Address); dlc != nil && dlc.Address != gkc.Address {
+		return fmt.Errorf("dead letter topic %s is not on the global kafka cluster", dlc.Topic)
+	}
+	if p := pc.OutputConfig.Producer; p != nil && p.Acks != "" && p.Acks != "all" {
+		return fmt.Errorf("acks must be all")
+	}
+	return nil
 }
 
 type RedisConfig struct {
@@ -93,6 +456,11 @@ type RedisConfig struct {
 type MemcachedConfig struct {
 	Name      string   `yaml:"name"`
 	Addresses []string `yaml:"addresses"`
+
+	// KeyIndex keeps the keys of the store in an index sharded over 64 items, so they can be scanned. It costs extra
+	// round trips on writes of new keys and on deletes. Expired keys are pruned from the index when a scan starts,
+	// and from a shard when it reaches the memcached item size.
+	KeyIndex bool `yaml:"keyIndex"`
 }
 
 type GlobalStoreConfig struct {
@@ -101,6 +469,10 @@ type GlobalStoreConfig struct {
 }
 
 type RootConfig struct {
+	// PipelineName is the name of the stream processing pipeline. Keys of state stores are namespaced by pipeline,
+	// processor and store, so pipelines sharing a global store do not mix their keys. Optional.
+	PipelineName string `yaml:"pipelineName"`
+
 	// ProcessorConfigs defines all the processors in the stream processing pipeline. At least one processor config
 	// must be provided.
 	ProcessorConfigs []*ProcessorConfig `yaml:"processorConfigs"`
@@ -116,6 +488,9 @@ func (rc *RootConfig) Validate() error {
 	if len(rc.ProcessorConfigs) == 0 {
 		return fmt.Errorf("no processor is specified in config")
 	}
+	if strings.Contains(rc.PipelineName, "/") {
+		return fmt.Errorf("pipeline name cannot contain /")
+	}
 	processorNameSet := make(map[string]bool, 0)
 	for _, pc := range rc.ProcessorConfigs {
 		// check name
@@ -145,14 +520,91 @@ func (rc *RootConfig) Validate() error {
 				return fmt.Errorf("processor with type=join must have more than one input sources")
 			}
 
-			// check window size
-			if pc.WindowSize < consts.JoinMinWindowSize {
-				return fmt.Errorf("window size is smaller than minimum")
+			// records of an input are told apart by their topics
+			inputTopics := make(map[string]bool, 0)
+			for _, topic := range pc.InputProcessors {
+				if inputTopics[topic] {
+					return fmt.Errorf("processor %s joins input %s more than once", name, topic)
+				}
+				inputTopics[topic] = true
+			}
+			for _, kc := range pc.InputKafkaConfigs {
+				if inputTopics[kc.Topic] {
+					return fmt.Errorf("processor %s joins input %s more than once", name, kc.Topic)
+				}
+				inputTopics[kc.Topic] = true
+			}
+
+			// check window
+			if len(pc.TableInputs) > 0 {
+				if err := pc.validateTableInputs(inputTopics); err != nil {
+					return fmt.Errorf("invalid table inputs for processor %s: %v", name, err)
+				}
+			} else if err := pc.validateWindow(); err != nil {
+				return fmt.Errorf("invalid window for processor %s: %v", name, err)
+			}
+
+			// check join type
+			switch pc.JoinType {
+			case "", consts.JoinTypeInner, consts.JoinTypeLeft, consts.JoinTypeRight, consts.JoinTypeFull:
+			default:
+				return fmt.Errorf("unrecognized join type %s for processor %s", pc.JoinType, name)
+			}
+
+			// check time mode
+			if err := pc.validateTimeMode(); err != nil {
+				return fmt.Errorf("invalid time mode for processor %s: %v", name, err)
+			}
+		case consts.ProcessorTypeAggregate:
+			if inputCount != 1 {
+				return fmt.Errorf("processor with type=aggregate must have one and only one input source")
+			}
+			if pc.OutputConfig == nil || pc.OutputConfig.DefaultTopicPartitions <= 0 {
+				return fmt.Errorf("processor %s with type=aggregate must have a default output topic", name)
+			}
+
+			// check window
+			if pc.WindowType == consts.WindowTypeSliding || pc.WindowType == consts.WindowTypeInterval {
+				return fmt.Errorf("processor with type=aggregate does not support %s window", pc.WindowType)
+			}
+			if err := pc.validateWindow(); err != nil {
+				return fmt.Errorf("invalid window for processor %s: %v", name, err)
+			}
+
+			// check time mode
+			if err := pc.validateTimeMode(); err != nil {
+				return fmt.Errorf("invalid time mode for processor %s: %v", name, err)
 			}
 		default:
 			return consts.ErrProcessorTypeNotRecognized
 		}
 
+		// check state store
+		if pc.StateStore != "" || pc.Type == consts.ProcessorTypeJoin || pc.Type == consts.ProcessorTypeAggregate {
+			if !rc.hasStateStore(pc.stateStoreName()) {
+				return fmt.Errorf("state store %s of processor %s is not found", pc.stateStoreName(), name)
+			}
+		}
+		if pc.StateRetention < 0 {
+			return fmt.Errorf("StateRetention must be greater than or equal to 0 for processor %s", name)
+		}
+		if cl := pc.StateChangelog; cl != nil && cl.Enabled {
+			if !isLocalStateStore(pc.stateStoreName()) {
+				return fmt.Errorf("state store %s of processor %s with changelog is not a local cache",
+					pc.stateStoreName(), name)
+			}
+			if cl.Partitions < 0 {
+				return fmt.Errorf("changelog partitions must be greater than or equal to 0 for processor %s", name)
+			}
+			// panes of join and aggregate processors hold records of all partitions of a pod
+			if pc.Type != consts.ProcessorTypeProcess {
+				return fmt.Errorf("processor %s with type=%s does not support changelog", name, pc.Type)
+			}
+			if len(pc.InputProcessors)+len(pc.InputKafkaConfigs) != 1 {
+				return fmt.Errorf("processor %s with changelog must have exactly one input", name)
+			}
+		}
+
 		if pc.NumOfWorker <= 0 {
 			return fmt.Errorf("NumOfWorker must be greater than 0 for processor %s", name)
 		}
@@ -162,6 +614,26 @@ func (rc *RootConfig) Validate() error {
 		if pc.OutputConfig.DefaultTopicPartitions < 0 {
 			return fmt.Errorf("DefaultTopicPartitions must be greater than or equal to 0 for processor %s", name)
 		}
+		if pc.OutputConfig.Producer != nil {
+			if err := pc.OutputConfig.Producer.Validate(); err != nil {
+				return fmt.Errorf("invalid producer config for processor %s: %v", name, err)
+			}
+		}
+		if pc.RetryPolicy != nil {
+			if err := pc.RetryPolicy.Validate(); err != nil {
+				return fmt.Errorf("invalid retry policy for processor %s: %v", name, err)
+			}
+		}
+	}
+
+	// check exactly once
+	for _, pc := range rc.ProcessorConfigs {
+		if !pc.ExactlyOnce {
+			continue
+		}
+		if err := pc.validateExactlyOnce(rc.GlobalKafkaConfig); err != nil {
+			return fmt.Errorf("invalid exactly once config for processor %s: %v", pc.Name, err)
+		}
 	}
 
 	// check input processor name
@@ -202,6 +674,33 @@ func (rc *RootConfig) Validate() error {
 			}
 			okcNameSet[okc.Name] = true
 		}
+
+		for outputName, partitioner := range pc.OutputConfig.Partitioners {
+			isOutput := outputName == pc.Name && pc.OutputConfig.DefaultTopicPartitions > 0
+			for _, op := range pc.OutputConfig.OutputProcessors {
+				isOutput = isOutput || op == outputName
+			}
+			isOutput = isOutput || okcNameSet[outputName]
+			if !isOutput {
+				return fmt.Errorf("partitioner of processor %s is defined for unknown output %s", pc.Name, outputName)
+			}
+			if partitioner == nil {
+				return fmt.Errorf("partitioner of output %s in processor %s is empty", outputName, pc.Name)
+			}
+			if err := partitioner.Validate(); err != nil {
+				return fmt.Errorf("invalid partitioner of output %s in processor %s: %v", outputName, pc.Name, err)
+			}
+		}
+
+		if dl := pc.OutputConfig.DeadLetter; dl != nil && dl.Enabled {
+			if dl.Partitions < 0 {
+				return fmt.Errorf("dead letter partitions must be greater than or equal to 0 for processor %s", pc.Name)
+			}
+			if processorNameSet[dl.Topic] {
+				return fmt.Errorf("dead letter topic %s in processor %s is duplicated with processor names",
+					dl.Topic, pc.Name)
+			}
+		}
 	}
 
 	if rc.GlobalKafkaConfig == nil {
@@ -225,6 +724,9 @@ func (rc *RootConfig) Validate() error {
 			if redisNames[redisConfig.Name] {
 				return fmt.Errorf("redis config name should not duplicate")
 			}
+			if isLocalStateStore(redisConfig.Name) {
+				return fmt.Errorf("redis config name %s is reserved for local cache", redisConfig.Name)
+			}
 			redisNames[redisConfig.Name] = true
 			if redisConfig.Address == "" {
 				return fmt.Errorf("redis config address cannot be empty")
@@ -238,6 +740,12 @@ func (rc *RootConfig) Validate() error {
 			if memcachedNames[mc.Name] {
 				return fmt.Errorf("memcached config name should not duplicate")
 			}
+			if isLocalStateStore(mc.Name) {
+				return fmt.Errorf("memcached config name %s is reserved for local cache", mc.Name)
+			}
+			if redisNames[mc.Name] {
+				return fmt.Errorf("memcached config name %s is used by a redis config", mc.Name)
+			}
 			memcachedNames[mc.Name] = true
 			if len(mc.Addresses) == 0 {
 				return fmt.Errorf("memcached config address cannot be empty")
@@ -248,22 +756,134 @@ func (rc *RootConfig) Validate() error {
 	return nil
 }
 
+// hasStateStore returns whether name is a local cache or a store in the global store config.
+func (rc *RootConfig) hasStateStore(name string) bool {
+	if isLocalStateStore(name) {
+		return true
+	}
+	if rc.GlobalStoreConfig == nil {
+		return false
+	}
+	for _, redisConfig := range rc.GlobalStoreConfig.RedisConfigs {
+		if redisConfig.Name == name {
+			return true
+		}
+	}
+	for _, mc := range rc.GlobalStoreConfig.MemcachedConfigs {
+		if mc.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isLocalStateStore(name string) bool {
+	return name == consts.StateStoreFreeCache || name == consts.StateStoreBigCache
+}
+
+// TopologicalOrder returns processor names in topological order, where a processor always comes after the
+// processors it consumes from. Processors are connected through the topics they produce to and consume from.
+func (rc *RootConfig) TopologicalOrder() ([]string, error) {
+	// topic -> names of processors producing to it
+	producersOfTopic := make(map[string][]string, 0)
+	for _, pc := range rc.ProcessorConfigs {
+		outputTopics := make([]string, 0)
+		if pc.OutputConfig != nil {
+			if pc.OutputConfig.DefaultTopicPartitions > 0 {
+				outputTopics = append(outputTopics, pc.Name)
+			}
+			outputTopics = append(outputTopics, pc.OutputConfig.OutputProcessors...)
+			for _, okc := range pc.OutputConfig.OutputKafkaConfigs {
+				outputTopics = append(outputTopics, okc.Topic)
+			}
+		}
+		for _, topic := range outputTopics {
+			producersOfTopic[topic] = append(producersOfTopic[topic], pc.Name)
+		}
+	}
+
+	inDegrees := make(map[string]int, 0)
+	downstreams := make(map[string][]string, 0)
+	for _, pc := range rc.ProcessorConfigs {
+		inputTopics := make([]string, 0)
+		inputTopics = append(inputTopics, pc.InputProcessors...)
+		for _, kc := range pc.InputKafkaConfigs {
+			inputTopics = append(inputTopics, kc.Topic)
+		}
+		upstreamSet := make(map[string]bool, 0)
+		for _, topic := range inputTopics {
+			for _, upstream := range producersOfTopic[topic] {
+				if upstream == pc.Name || upstreamSet[upstream] {
+					continue
+				}
+				upstreamSet[upstream] = true
+				downstreams[upstream] = append(downstreams[upstream], pc.Name)
+			}
+		}
+		inDegrees[pc.Name] = len(upstreamSet)
+	}
+
+	// Kahn's algorithm. Ties are broken by the order in config.
+	order := make([]string, 0, len(rc.ProcessorConfigs))
+	visited := make(map[string]bool, 0)
+	for len(order) < len(rc.ProcessorConfigs) {
+		progressed := false
+		for _, pc := range rc.ProcessorConfigs {
+			if visited[pc.Name] || inDegrees[pc.Name] > 0 {
+				continue
+			}
+			visited[pc.Name] = true
+			order = append(order, pc.Name)
+			for _, downstream := range downstreams[pc.Name] {
+				inDegrees[downstream]--
+			}
+			progressed = true
+		}
+		if !progressed {
+			return nil, fmt.Errorf("processors form a cycle")
+		}
+	}
+	return order, nil
+}
+
 type ConsumerConfig struct {
 	Address      string `json:"address"`
 	Topic        string `json:"topic"`
 	NumOfWorkers int    `json:"num_of_workers"`
 	TopicIndex   int    `json:"topic_index"`
+
+	// Table is true if the input is a table of a join processor, which is materialised instead of consumed by workers.
+	Table bool `json:"table"`
 }
 
 type InternalProcessorConfig struct {
-	Name                     string                  `json:"name"`
-	Type                     string                  `json:"type"`
-	GlobalKafkaConfig        *GlobalKafkaConfig      `json:"global_kafka_config"`
-	ConsumerConfigs          []*ConsumerConfig       `json:"consumer_configs"`
-	DefaultOutputKafkaConfig *KafkaConfig            `json:"default_output_kafka_config"`
-	OutputKafkaConfigs       map[string]*KafkaConfig `json:"output_kafka_configs"`
-	GlobalStoreConfig        *GlobalStoreConfig      `json:"global_store_config"`
-	WindowSize               int                     `json:"window_size"`
+	Name                     string                        `json:"name"`
+	PipelineName             string                        `json:"pipeline_name"`
+	Type                     string                        `json:"type"`
+	GlobalKafkaConfig        *GlobalKafkaConfig            `json:"global_kafka_config"`
+	ConsumerConfigs          []*ConsumerConfig             `json:"consumer_configs"`
+	DefaultOutputKafkaConfig *KafkaConfig                  `json:"default_output_kafka_config"`
+	OutputKafkaConfigs       map[string]*KafkaConfig       `json:"output_kafka_configs"`
+	GlobalStoreConfig        *GlobalStoreConfig            `json:"global_store_config"`
+	DeadLetterKafkaConfig    *KafkaConfig                  `json:"dead_letter_kafka_config"`
+	ChangelogKafkaConfig     *KafkaConfig                  `json:"changelog_kafka_config"`
+	ProducerConfig           *ProducerConfig               `json:"producer_config"`
+	Partitioners             map[string]*PartitionerConfig `json:"partitioners"`
+	WindowType               string                        `json:"window_type"`
+	WindowSize               int                           `json:"window_size"`
+	WindowSlide              int                           `json:"window_slide"`
+	SessionGap               int                           `json:"session_gap"`
+	IntervalLower            int                           `json:"interval_lower"`
+	IntervalUpper            int                           `json:"interval_upper"`
+	TimeMode                 string                        `json:"time_mode"`
+	MaxOutOfOrderness        int                           `json:"max_out_of_orderness"`
+	AllowedLateness          int                           `json:"allowed_lateness"`
+	RetryPolicy              *RetryPolicyConfig            `json:"retry_policy"`
+	ExactlyOnce              bool                          `json:"exactly_once"`
+	CrossJoin                bool                          `json:"cross_join"`
+	JoinType                 string                        `json:"join_type"`
+	StateStore               string                        `json:"state_store"`
+	StateRetention           int                           `json:"state_retention"`
 }
 
 func NewInternalProcessorConfig(rootConfig *RootConfig, processorName string) *InternalProcessorConfig {
@@ -271,6 +891,7 @@ func NewInternalProcessorConfig(rootConfig *RootConfig, processorName string) *I
 		Name:              processorName,
 		GlobalKafkaConfig: rootConfig.GlobalKafkaConfig,
 		GlobalStoreConfig: rootConfig.GlobalStoreConfig,
+		PipelineName:      rootConfig.PipelineName,
 	}
 
 	kafkaAddr := rootConfig.GlobalKafkaConfig.Address
@@ -280,7 +901,30 @@ func NewInternalProcessorConfig(rootConfig *RootConfig, processorName string) *I
 		}
 
 		ipc.Type = processorConfig.Type
+		ipc.WindowType = processorConfig.WindowType
+		if ipc.WindowType == "" {
+			ipc.WindowType = consts.WindowTypeTumbling
+		}
 		ipc.WindowSize = processorConfig.WindowSize
+		ipc.WindowSlide = processorConfig.WindowSlide
+		ipc.SessionGap = processorConfig.SessionGap
+		ipc.IntervalLower = processorConfig.IntervalLower
+		ipc.IntervalUpper = processorConfig.IntervalUpper
+		ipc.TimeMode = processorConfig.TimeMode
+		if ipc.TimeMode == "" {
+			ipc.TimeMode = consts.TimeModeProcessingTime
+		}
+		ipc.MaxOutOfOrderness = processorConfig.MaxOutOfOrderness
+		ipc.AllowedLateness = processorConfig.AllowedLateness
+		ipc.RetryPolicy = processorConfig.RetryPolicy
+		ipc.ExactlyOnce = processorConfig.ExactlyOnce
+		ipc.CrossJoin = processorConfig.CrossJoin
+		ipc.JoinType = processorConfig.JoinType
+		if ipc.JoinType == "" {
+			ipc.JoinType = consts.JoinTypeInner
+		}
+		ipc.StateStore = processorConfig.stateStoreName()
+		ipc.StateRetention = processorConfig.StateRetention
 
 		consumerConfigs := make([]*ConsumerConfig, 0)
 		topicIndex := 0
@@ -292,6 +936,7 @@ func NewInternalProcessorConfig(rootConfig *RootConfig, processorName string) *I
 				TopicIndex:   topicIndex,
 			}
 			topicIndex++
+			cc.Table = processorConfig.isTableInput(cc.Topic)
 			consumerConfigs = append(consumerConfigs, cc)
 		}
 		for _, inputKakfaConfig := range processorConfig.InputKafkaConfigs {
@@ -302,6 +947,7 @@ func NewInternalProcessorConfig(rootConfig *RootConfig, processorName string) *I
 				TopicIndex:   topicIndex,
 			}
 			topicIndex++
+			cc.Table = processorConfig.isTableInput(cc.Topic)
 			consumerConfigs = append(consumerConfigs, cc)
 		}
 		ipc.ConsumerConfigs = consumerConfigs
@@ -329,6 +975,18 @@ func NewInternalProcessorConfig(rootConfig *RootConfig, processorName string) *I
 			outputMap[key] = val
 		}
 		ipc.OutputKafkaConfigs = outputMap
+		ipc.DeadLetterKafkaConfig = processorConfig.DeadLetterKafkaConfig(kafkaAddr)
+		ipc.ChangelogKafkaConfig = processorConfig.ChangelogKafkaConfig(kafkaAddr)
+		ipc.ProducerConfig = processorConfig.OutputConfig.Producer
+
+		ipc.Partitioners = make(map[string]*PartitionerConfig, 0)
+		for outputName, partitioner := range processorConfig.OutputConfig.Partitioners {
+			if outputName == processorConfig.Name && ipc.DefaultOutputKafkaConfig != nil {
+				ipc.Partitioners[ipc.DefaultOutputKafkaConfig.Topic] = partitioner
+			} else if kc, exists := outputMap[outputName]; exists {
+				ipc.Partitioners[kc.Topic] = partitioner
+			}
+		}
 	}
 	return ipc
 }
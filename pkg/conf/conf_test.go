@@ -0,0 +1,379 @@
+package conf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRootConfig_TopologicalOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		processors []*ProcessorConfig
+		want       []string
+		wantErr    bool
+	}{
+		{
+			name: "word count",
+			processors: []*ProcessorConfig{
+				{
+					Name:            "counter",
+					InputProcessors: []string{"splitter"},
+					OutputConfig:    &OutputConfig{},
+				},
+				{
+					Name:              "splitter",
+					InputKafkaConfigs: []*KafkaConfig{{Topic: "word_count_source"}},
+					OutputConfig:      &OutputConfig{DefaultTopicPartitions: 3},
+				},
+			},
+			want: []string{"splitter", "counter"},
+		},
+		{
+			name: "orderline join",
+			processors: []*ProcessorConfig{
+				{
+					Name:              "orderlineparse",
+					InputKafkaConfigs: []*KafkaConfig{{Topic: "orderline_source"}},
+					OutputConfig: &OutputConfig{
+						DefaultTopicPartitions: 2,
+						OutputKafkaConfigs:     []*NamedKafkaConfig{{Name: "orderparse", Topic: "orderparse"}},
+					},
+				},
+				{
+					Name:              "orderlinejoin",
+					InputKafkaConfigs: []*KafkaConfig{{Topic: "orderparse"}, {Topic: "orderlineparse"}},
+					OutputConfig:      &OutputConfig{DefaultTopicPartitions: 1},
+				},
+			},
+			want: []string{"orderlineparse", "orderlinejoin"},
+		},
+		{
+			name: "cycle",
+			processors: []*ProcessorConfig{
+				{
+					Name:            "a",
+					InputProcessors: []string{"b"},
+					OutputConfig:    &OutputConfig{DefaultTopicPartitions: 1},
+				},
+				{
+					Name:            "b",
+					InputProcessors: []string{"a"},
+					OutputConfig:    &OutputConfig{DefaultTopicPartitions: 1},
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &RootConfig{ProcessorConfigs: tt.processors}
+			got, err := rc.TopologicalOrder()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TopologicalOrder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TopologicalOrder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRootConfig_ValidateJoinInputs(t *testing.T) {
+	newRootConfig := func(inputProcessors []string, inputKafkaConfigs []*KafkaConfig) *RootConfig {
+		processors := []*ProcessorConfig{
+			{
+				Name:              "join",
+				EntryPoint:        "JoinHandler",
+				Type:              "join",
+				NumOfWorker:       1,
+				WindowSize:        30,
+				InputProcessors:   inputProcessors,
+				InputKafkaConfigs: inputKafkaConfigs,
+				OutputConfig:      &OutputConfig{DefaultTopicPartitions: 1},
+			},
+		}
+		for _, name := range inputProcessors {
+			processors = append(processors, &ProcessorConfig{
+				Name:              name,
+				EntryPoint:        "ParseHandler",
+				Type:              "process",
+				NumOfWorker:       1,
+				InputKafkaConfigs: []*KafkaConfig{{Address: "kafka:9092", Topic: name + "_source"}},
+				OutputConfig:      &OutputConfig{DefaultTopicPartitions: 1},
+			})
+		}
+		return &RootConfig{
+			ProcessorConfigs:  processors,
+			GlobalKafkaConfig: &GlobalKafkaConfig{Address: "kafka:9092"},
+			GlobalStoreConfig: &GlobalStoreConfig{
+				RedisConfigs: []*RedisConfig{{Name: "state-redis", Address: "state-redis:6379"}},
+			},
+		}
+	}
+	tests := []struct {
+		name    string
+		rc      *RootConfig
+		wantErr bool
+	}{
+		{
+			name: "three inputs",
+			rc: newRootConfig([]string{"order", "orderline"},
+				[]*KafkaConfig{{Address: "kafka:9092", Topic: "product"}}),
+		},
+		{
+			name:    "duplicate input processor",
+			rc:      newRootConfig([]string{"order", "order"}, nil),
+			wantErr: true,
+		},
+		{
+			name: "input kafka config duplicates input processor",
+			rc: newRootConfig([]string{"order"},
+				[]*KafkaConfig{{Address: "kafka:9092", Topic: "order"}}),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rc.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRootConfig_ValidateStateStore(t *testing.T) {
+	newRootConfig := func(stateStore string) *RootConfig {
+		return &RootConfig{
+			ProcessorConfigs: []*ProcessorConfig{
+				{
+					Name:        "join",
+					EntryPoint:  "JoinHandler",
+					Type:        "join",
+					NumOfWorker: 1,
+					WindowSize:  30,
+					StateStore:  stateStore,
+					InputKafkaConfigs: []*KafkaConfig{
+						{Address: "kafka:9092", Topic: "order"},
+						{Address: "kafka:9092", Topic: "orderline"},
+					},
+					OutputConfig: &OutputConfig{DefaultTopicPartitions: 1},
+				},
+			},
+			GlobalKafkaConfig: &GlobalKafkaConfig{Address: "kafka:9092"},
+			GlobalStoreConfig: &GlobalStoreConfig{
+				MemcachedConfigs: []*MemcachedConfig{{Name: "state-memcached", Addresses: []string{"state-memcached:11211"}}},
+			},
+		}
+	}
+	tests := []struct {
+		name       string
+		stateStore string
+		wantErr    bool
+	}{
+		{
+			name:       "memcached",
+			stateStore: "state-memcached",
+		},
+		{
+			name:       "local cache",
+			stateStore: "freecache",
+		},
+		{
+			name:       "default redis not configured",
+			stateStore: "",
+			wantErr:    true,
+		},
+		{
+			name:       "not found",
+			stateStore: "state-dynamo",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := newRootConfig(tt.stateStore).Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRootConfig_ValidateTableInputs(t *testing.T) {
+	newRootConfig := func(tableInputs []string, joinType string) *RootConfig {
+		return &RootConfig{
+			ProcessorConfigs: []*ProcessorConfig{
+				{
+					Name:        "join",
+					EntryPoint:  "JoinHandler",
+					Type:        "join",
+					NumOfWorker: 1,
+					JoinType:    joinType,
+					StateStore:  "freecache",
+					TableInputs: tableInputs,
+					InputKafkaConfigs: []*KafkaConfig{
+						{Address: "kafka:9092", Topic: "order"},
+						{Address: "kafka:9092", Topic: "customer"},
+						{Address: "kafka:9092", Topic: "product"},
+					},
+					OutputConfig: &OutputConfig{DefaultTopicPartitions: 1},
+				},
+			},
+			GlobalKafkaConfig: &GlobalKafkaConfig{Address: "kafka:9092"},
+		}
+	}
+	tests := []struct {
+		name        string
+		tableInputs []string
+		joinType    string
+		wantErr     bool
+	}{
+		{
+			name:        "two tables",
+			tableInputs: []string{"customer", "product"},
+		},
+		{
+			name:        "left join",
+			tableInputs: []string{"customer", "product"},
+			joinType:    "left",
+		},
+		{
+			name:        "full join",
+			tableInputs: []string{"customer", "product"},
+			joinType:    "full",
+			wantErr:     true,
+		},
+		{
+			name:        "two streams",
+			tableInputs: []string{"customer"},
+			wantErr:     true,
+		},
+		{
+			name:        "not an input",
+			tableInputs: []string{"customer", "product", "supplier"},
+			wantErr:     true,
+		},
+		{
+			name:        "duplicated",
+			tableInputs: []string{"customer", "customer", "product"},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := newRootConfig(tt.tableInputs, tt.joinType).Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRootConfig_ValidateStateChangelog(t *testing.T) {
+	newRootConfig := func(processorType string, inputs []string, stateStore string,
+		changelog *ChangelogConfig) *RootConfig {
+
+		inputKafkaConfigs := make([]*KafkaConfig, 0)
+		for _, input := range inputs {
+			inputKafkaConfigs = append(inputKafkaConfigs, &KafkaConfig{Address: "kafka:9092", Topic: input})
+		}
+		return &RootConfig{
+			ProcessorConfigs: []*ProcessorConfig{
+				{
+					Name:              "enrich",
+					EntryPoint:        "EnrichHandler",
+					Type:              processorType,
+					NumOfWorker:       1,
+					WindowSize:        30,
+					StateStore:        stateStore,
+					StateChangelog:    changelog,
+					InputKafkaConfigs: inputKafkaConfigs,
+					OutputConfig:      &OutputConfig{DefaultTopicPartitions: 1},
+				},
+			},
+			GlobalKafkaConfig: &GlobalKafkaConfig{Address: "kafka:9092"},
+			GlobalStoreConfig: &GlobalStoreConfig{
+				MemcachedConfigs: []*MemcachedConfig{{Name: "state-memcached", Addresses: []string{"state-memcached:11211"}}},
+			},
+		}
+	}
+	tests := []struct {
+		name          string
+		processorType string
+		inputs        []string
+		stateStore    string
+		changelog     *ChangelogConfig
+		wantErr       bool
+	}{
+		{
+			name:       "local cache",
+			stateStore: "freecache",
+			changelog:  &ChangelogConfig{Enabled: true},
+		},
+		{
+			name:       "remote store",
+			stateStore: "state-memcached",
+			changelog:  &ChangelogConfig{Enabled: true},
+			wantErr:    true,
+		},
+		{
+			name:       "disabled on remote store",
+			stateStore: "state-memcached",
+			changelog:  &ChangelogConfig{},
+		},
+		{
+			name:       "negative partitions",
+			stateStore: "bigcache",
+			changelog:  &ChangelogConfig{Enabled: true, Partitions: -1},
+			wantErr:    true,
+		},
+		{
+			name:          "join",
+			processorType: "join",
+			inputs:        []string{"order", "orderline"},
+			stateStore:    "freecache",
+			changelog:     &ChangelogConfig{Enabled: true},
+			wantErr:       true,
+		},
+		{
+			name:          "disabled on join",
+			processorType: "join",
+			inputs:        []string{"order", "orderline"},
+			stateStore:    "freecache",
+			changelog:     &ChangelogConfig{},
+		},
+		{
+			name:          "aggregate",
+			processorType: "aggregate",
+			stateStore:    "freecache",
+			changelog:     &ChangelogConfig{Enabled: true},
+			wantErr:       true,
+		},
+		{
+			name:          "disabled on aggregate",
+			processorType: "aggregate",
+			stateStore:    "freecache",
+			changelog:     &ChangelogConfig{},
+		},
+		{
+			name:       "two inputs",
+			inputs:     []string{"order", "orderline"},
+			stateStore: "freecache",
+			changelog:  &ChangelogConfig{Enabled: true},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processorType, inputs := tt.processorType, tt.inputs
+			if processorType == "" {
+				processorType = "process"
+			}
+			if inputs == nil {
+				inputs = []string{"order"}
+			}
+			err := newRootConfig(processorType, inputs, tt.stateStore, tt.changelog).Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
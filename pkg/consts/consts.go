@@ -8,6 +8,9 @@ const (
 	CTX_KEY_INVOKER_LIB_WORKER_INDEX   = contextKey("invoker_lib_worker_index")
 	CTX_KEY_INVOKER_LIB_WORKER_TOPIC   = contextKey("invoker_lib_worker_topic")
 	CTX_KEY_INVOKER_LIB_CRON           = contextKey("invoker_lib_cron")
+	CTX_KEY_INVOKER_LIB_DELIVERY       = contextKey("invoker_lib_delivery")
+	CTX_KEY_INVOKER_LIB_TRANSACTION    = contextKey("invoker_lib_transaction")
+	CTX_KEY_INVOKER_LIB_PARTITION      = contextKey("invoker_lib_partition")
 )
 
 const (
@@ -26,13 +29,128 @@ const MetricsNamespace = "invoker"
 
 const DefaultCatLimit = 1000
 
+// DefaultScanCount is the number of keys asked for in each scan of a state store.
+const DefaultScanCount = 100
+
+// MemcachedKeyIndexKey is the key prefix of the shards of the key index in a memcached state store with a key
+// index. A key is indexed in the shard "<MemcachedKeyIndexKey>-<n>", where n is the hash of the key modulo
+// MemcachedKeyIndexShards.
+const (
+	MemcachedKeyIndexKey    = "invokerlib-key-index"
+	MemcachedKeyIndexShards = 64
+)
+
 const RedisPingRetryTimes = 3
 
 const (
-	ProcessorTypeProcess = "process"
-	ProcessorTypeJoin    = "join"
+	ProcessorTypeProcess   = "process"
+	ProcessorTypeJoin      = "join"
+	ProcessorTypeAggregate = "aggregate"
+)
+
+const (
+	TimeModeProcessingTime = "processingTime"
+	TimeModeEventTime      = "eventTime"
+)
+
+const (
+	WindowTypeTumbling = "tumbling"
+	WindowTypeHopping  = "hopping"
+	WindowTypeSliding  = "sliding"
+	WindowTypeSession  = "session"
+	WindowTypeInterval = "interval"
+)
+
+const (
+	JoinTypeInner = "inner"
+	JoinTypeLeft  = "left"
+	JoinTypeRight = "right"
+	JoinTypeFull  = "full"
+)
+
+const (
+	ProducerModeSync  = "sync"
+	ProducerModeAsync = "async"
+)
+
+// MaxInFlightMessagesPerClaim is the maximum number of consumed messages of a partition claim whose produced
+// records are not acknowledged yet.
+const MaxInFlightMessagesPerClaim = 10000
+
+// TransactionMaxMessages and TransactionCommitIntervalMs define when a transaction of a partition claim is
+// committed in exactly-once mode, whichever comes first.
+const (
+	TransactionMaxMessages      = 1000
+	TransactionCommitIntervalMs = 100
+)
+
+const (
+	PartitionerTypeHash       = "hash"
+	PartitionerTypeRoundRobin = "roundRobin"
+	PartitionerTypeSticky     = "sticky"
+	PartitionerTypeCallback   = "callback"
 )
 
+const (
+	// HashFNV1a is the hash used by sarama by default
+	HashFNV1a = "fnv1a"
+
+	// HashMurmur2 is the hash used by the Java Kafka client by default
+	HashMurmur2 = "murmur2"
+
+	// HashCRC32 is the hash used by the consistent partitioner of librdkafka
+	HashCRC32 = "crc32"
+)
+
+// StickyPartitionerBatchSize is the number of records that a sticky partitioner sends to one partition before
+// switching to another one.
+const StickyPartitionerBatchSize = 1000
+
+const DeadLetterTopicSuffix = "_dlq"
+
+const ChangelogTopicSuffix = "_changelog"
+
+// ChangelogHeaderExpireAt is the header of changelog records of keys that expire, which holds the unix time in
+// seconds when the key expires.
+const ChangelogHeaderExpireAt = "invoker-changelog-expire-at"
+
+// ChangelogHeaderKey and ChangelogHeaderCollection are the headers of changelog records of collection elements,
+// which hold the state store key of the collection, and whether the collection is a list or a set.
+const (
+	ChangelogHeaderKey        = "invoker-changelog-key"
+	ChangelogHeaderCollection = "invoker-changelog-collection"
+)
+
+// headers attached to records sent to dead letter topics
+const (
+	DeadLetterHeaderPrefix          = "invoker-dlq-"
+	DeadLetterHeaderError           = DeadLetterHeaderPrefix + "error"
+	DeadLetterHeaderStackTrace      = DeadLetterHeaderPrefix + "stack-trace"
+	DeadLetterHeaderProcessor       = DeadLetterHeaderPrefix + "processor"
+	DeadLetterHeaderSourceTopic     = DeadLetterHeaderPrefix + "source-topic"
+	DeadLetterHeaderSourcePartition = DeadLetterHeaderPrefix + "source-partition"
+	DeadLetterHeaderSourceOffset    = DeadLetterHeaderPrefix + "source-offset"
+)
+
+const DeadLetterRedriveGroupSuffix = "_redrive"
+
 const JoinKeyBufferMinCapacity = 8
 
 const JoinMinWindowSize = 10
+
+// CatchUpIdleMs is the time in milliseconds without new records after which a partition being read to its end is
+// considered caught up. CatchUpFirstRecordTimeoutMs is the time to wait for the first record, after which a
+// partition without any record to deliver is considered caught up.
+const (
+	CatchUpIdleMs               = 5000
+	CatchUpFirstRecordTimeoutMs = 60000
+	CatchUpCheckIntervalMs      = 100
+)
+
+// StateStoreFreeCache and StateStoreBigCache are the state store names of local caches. They cannot be used as
+// names of global stores.
+const (
+	StateStoreFreeCache = "freecache"
+	StateStoreBigCache  = "bigcache"
+	DefaultStateStore   = "state-redis"
+)
@@ -10,6 +10,7 @@ var (
 	ErrLockBufferFailure          = fmt.Errorf("fail to lock buffer")
 	ErrLockSlotFailure            = fmt.Errorf("fail to lock slot")
 	ErrStateStoreKeyNotExist      = fmt.Errorf("state store key does not exists")
+	ErrStateStoreWrongType        = fmt.Errorf("state store key holds a value of another type")
 )
 
 func ErrKakfaAddressEmpty(prefix string) error {
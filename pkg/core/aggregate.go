@@ -0,0 +1,395 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/TTraveller7/invokerlib/pkg/consts"
+	"github.com/TTraveller7/invokerlib/pkg/models"
+	"github.com/TTraveller7/invokerlib/pkg/state"
+)
+
+// paneAccumulator is the accumulator of a key in a pane, with the range of timestamps of the records added to it.
+type paneAccumulator struct {
+	Key   string `json:"key"`
+	Acc   []byte `json:"acc"`
+	MinTs int64  `json:"min_ts"`
+	MaxTs int64  `json:"max_ts"`
+
+	// PaneStart is set when the pane of the accumulator is closed
+	PaneStart int64 `json:"pane_start,omitempty"`
+}
+
+func accumulatorKey(bufferId string, key string) string {
+	return fmt.Sprintf("%s-acc-%s", bufferId, key)
+}
+
+func accumulatorState(s state.StateStore, bufferId string, key string) *state.ValueState[paneAccumulator] {
+	return state.NewValueState[paneAccumulator](s, accumulatorKey(bufferId, key), state.SonicCodec[paneAccumulator]{})
+}
+
+type AggregateWorker struct {
+	w          *Watermark
+	ps         *paneStore
+	topicIndex int
+	expireTime int
+	cb         *models.AggregateCallbacks
+}
+
+func NewAggregateWorker(w *Watermark, ps *paneStore, topicIndex int, expireTime int,
+	cb *models.AggregateCallbacks) *AggregateWorker {
+
+	return &AggregateWorker{
+		w:          w,
+		ps:         ps,
+		topicIndex: topicIndex,
+		expireTime: expireTime,
+		cb:         cb,
+	}
+}
+
+// AggregateWorkerProcessCallback adds a record to the accumulator of its key in the buffer of its pane and
+// partition. The keys of a buffer are stored in a set under the buffer id.
+func (a *AggregateWorker) AggregateWorkerProcessCallback(ctx context.Context, record *models.Record) error {
+	ts := time.Now().Unix()
+	if a.w.IsEventTime() && !record.Timestamp().IsZero() {
+		ts = record.Timestamp().Unix()
+	}
+	paneStart, ok := a.w.Assign(ts)
+	if !ok {
+		// drop record
+		metricsClient.EmitCounter("aggregate_late_record", "Number of records dropped because their window is closed", 1)
+		return nil
+	}
+
+	// in processing time mode, the record may be assigned to a pane that has ended
+	if ts >= paneStart+a.w.Size() {
+		ts = paneStart + a.w.Size() - 1
+	}
+
+	pb := paneBuffer{
+		Id:         a.ps.bufferId(paneStart, a.topicIndex, record.Partition()),
+		TopicIndex: a.topicIndex,
+	}
+	if err := a.ps.register(ctx, paneStart, pb); err != nil {
+		return err
+	}
+	accState := accumulatorState(a.ps.s, pb.Id, record.Key())
+	isNewKey := false
+	pa, err := accState.Get(ctx)
+	if err == consts.ErrStateStoreKeyNotExist {
+		isNewKey = true
+		pa = paneAccumulator{
+			Key:   record.Key(),
+			MinTs: ts,
+			MaxTs: ts,
+		}
+		pa.Acc, err = a.cb.Init()
+		if err != nil {
+			return fmt.Errorf("aggregate init callback failed: %v", err)
+		}
+	} else if err != nil {
+		return err
+	} else {
+		if ts < pa.MinTs {
+			pa.MinTs = ts
+		}
+		if ts > pa.MaxTs {
+			pa.MaxTs = ts
+		}
+	}
+	pa.Acc, err = a.cb.Add(ctx, pa.Acc, record)
+	if err != nil {
+		return fmt.Errorf("aggregate add callback failed: %v", err)
+	}
+
+	if isNewKey {
+		if err := a.ps.s.SetAdd(ctx, pb.Id, []byte(record.Key())); err != nil {
+			return err
+		}
+	}
+	return accState.PutWithExpireTime(ctx, pa, a.expireTime)
+}
+
+// windowAggregator merges the accumulators of closed panes into windows, which are made of panes in the same way
+// as the windows of windowJoiner. Sliding windows are not supported. Accumulators are kept in memory while they
+// may belong to a window that is not closed yet. closePane is called with panes in order, and is not safe for
+// concurrent use.
+type windowAggregator struct {
+	windowType string
+	size       int64
+	slide      int64
+	gap        int64
+
+	merge func(a []byte, b []byte) ([]byte, error)
+
+	// accumulators of closed panes that belong to windows not closed yet
+	pending []*paneAccumulator
+
+	// lastPane is the start of the last closed pane, or 0 if no pane is closed
+	lastPane int64
+}
+
+// aggregateResult is the accumulator of a key in a closed window.
+type aggregateResult struct {
+	key    string
+	window models.Window
+	acc    []byte
+}
+
+func newWindowAggregator(windowType string, size int64, slide int64, gap int64,
+	merge func(a []byte, b []byte) ([]byte, error)) *windowAggregator {
+
+	if windowType == "" {
+		windowType = consts.WindowTypeTumbling
+	}
+	return &windowAggregator{
+		windowType: windowType,
+		size:       size,
+		slide:      slide,
+		gap:        gap,
+		merge:      merge,
+		pending:    make([]*paneAccumulator, 0),
+	}
+}
+
+// paneSize returns the size of panes in seconds.
+func (wa *windowAggregator) paneSize() int64 {
+	switch wa.windowType {
+	case consts.WindowTypeHopping:
+		return wa.slide
+	case consts.WindowTypeSession:
+		return wa.gap
+	default:
+		return wa.size
+	}
+}
+
+// closePane adds the accumulators of the pane starting at paneStart, and returns the results of the windows closed
+// with the pane.
+func (wa *windowAggregator) closePane(paneStart int64, accs []*paneAccumulator) ([]*aggregateResult, error) {
+	wa.lastPane = paneStart
+	for _, pa := range accs {
+		pa.PaneStart = paneStart
+	}
+	paneEnd := paneStart + wa.paneSize()
+	switch wa.windowType {
+	case consts.WindowTypeHopping:
+		// the window ending at the pane end is closed, and panes before the next window are not needed
+		wa.pending = append(wa.pending, accs...)
+		window := models.Window{Start: paneEnd - wa.size, End: paneEnd}
+		inWindow := make([]*paneAccumulator, 0, len(wa.pending))
+		pending := make([]*paneAccumulator, 0, len(wa.pending))
+		for _, pa := range wa.pending {
+			if pa.PaneStart >= window.Start {
+				inWindow = append(inWindow, pa)
+			}
+			if pa.PaneStart >= window.Start+wa.slide {
+				pending = append(pending, pa)
+			}
+		}
+		wa.pending = pending
+		return wa.mergeByKey(inWindow, window)
+	case consts.WindowTypeSession:
+		wa.pending = append(wa.pending, accs...)
+		return wa.closeSessions(paneEnd)
+	default:
+		return wa.mergeByKey(accs, models.Window{Start: paneStart, End: paneEnd})
+	}
+}
+
+// mergeByKey merges the accumulators of each key in window.
+func (wa *windowAggregator) mergeByKey(accs []*paneAccumulator, window models.Window) ([]*aggregateResult, error) {
+	results := make([]*aggregateResult, 0)
+	resultOfKey := make(map[string]*aggregateResult, 0)
+	for _, pa := range accs {
+		res, exists := resultOfKey[pa.Key]
+		if !exists {
+			res = &aggregateResult{
+				key:    pa.Key,
+				window: window,
+				acc:    pa.Acc,
+			}
+			resultOfKey[pa.Key] = res
+			results = append(results, res)
+			continue
+		}
+		merged, err := wa.merge(res.acc, pa.Acc)
+		if err != nil {
+			return nil, fmt.Errorf("aggregate merge callback failed: %v", err)
+		}
+		res.acc = merged
+	}
+	return results, nil
+}
+
+// closeSessions merges the accumulators of each key into sessions, and returns the sessions that cannot be
+// extended by records at or after paneEnd. The window of a session is [first timestamp, last timestamp + 1).
+func (wa *windowAggregator) closeSessions(paneEnd int64) ([]*aggregateResult, error) {
+	// keys are visited in the order they are first seen
+	keys := make([]string, 0)
+	accsOfKey := make(map[string][]*paneAccumulator, 0)
+	for _, pa := range wa.pending {
+		if _, exists := accsOfKey[pa.Key]; !exists {
+			keys = append(keys, pa.Key)
+		}
+		accsOfKey[pa.Key] = append(accsOfKey[pa.Key], pa)
+	}
+
+	results := make([]*aggregateResult, 0)
+	pending := make([]*paneAccumulator, 0)
+	for _, key := range keys {
+		accs := accsOfKey[key]
+		sort.SliceStable(accs, func(i, j int) bool {
+			return accs[i].MinTs < accs[j].MinTs
+		})
+		session := *accs[0]
+		for i := 1; i <= len(accs); i++ {
+			if i < len(accs) && accs[i].MinTs-session.MaxTs <= wa.gap {
+				merged, err := wa.merge(session.Acc, accs[i].Acc)
+				if err != nil {
+					return nil, fmt.Errorf("aggregate merge callback failed: %v", err)
+				}
+				session.Acc = merged
+				if accs[i].MaxTs > session.MaxTs {
+					session.MaxTs = accs[i].MaxTs
+				}
+				continue
+			}
+			if session.MaxTs+wa.gap >= paneEnd {
+				kept := session
+				pending = append(pending, &kept)
+			} else {
+				results = append(results, &aggregateResult{
+					key:    key,
+					window: models.Window{Start: session.MinTs, End: session.MaxTs + 1},
+					acc:    session.Acc,
+				})
+			}
+			if i < len(accs) {
+				session = *accs[i]
+			}
+		}
+	}
+	wa.pending = pending
+	return results, nil
+}
+
+// asyncAggregate loads the accumulators of the pane starting at paneStart, and emits the results of the windows
+// closed with the pane to the default output topic.
+func asyncAggregate(ctx context.Context, paneStart int64, aggregator *windowAggregator,
+	cb *models.AggregateCallbacks, ps *paneStore) {
+
+	asyncAggregatePrefix := fmt.Sprintf("[async aggregate at %v] ", paneStart)
+	logs := log.New(os.Stdout, asyncAggregatePrefix, log.LstdFlags|log.Lshortfile)
+	startTime := time.Now()
+	defer func() {
+		elapsedTime := time.Since(startTime).Milliseconds()
+		metricsClient.EmitHistogram("aggregate_process_time", "Process time for aggregating records in a window",
+			float64(elapsedTime))
+	}()
+
+	// fetch the accumulators of each buffer in the pane
+	accs := make([]*paneAccumulator, 0)
+	buffers, err := ps.buffers(ctx, paneStart)
+	if err != nil {
+		logs.Printf("async aggregate fetch buffers failed: %v", err)
+		return
+	}
+	deletedKeys := make([]string, 0)
+	deleteBuffers := func() {
+		if err := state.MultiDelete(ctx, ps.s, deletedKeys); err != nil {
+			logs.Printf("async aggregate delete state failed: %v", err)
+		}
+	}
+	for _, pb := range buffers {
+		deletedKeys = append(deletedKeys, pb.Id)
+		bufferAccs, err := fetchAccumulators(ctx, ps.s, pb.Id)
+		if err != nil {
+			logs.Printf("async aggregate fetch accumulators failed: %v", err)
+			return
+		}
+		for _, pa := range bufferAccs {
+			deletedKeys = append(deletedKeys, accumulatorKey(pb.Id, pa.Key))
+		}
+		accs = append(accs, bufferAccs...)
+	}
+	if paneStart <= aggregator.lastPane {
+		// the pane was aggregated by a previous run, which stopped before closing it in the pane store
+		deleteBuffers()
+		return
+	}
+
+	results, err := aggregator.closePane(paneStart, accs)
+	if err != nil {
+		logs.Printf("async aggregate: %v", err)
+		return
+	}
+	for _, res := range results {
+		record, err := cb.Emit(ctx, res.key, res.window, res.acc)
+		if err == nil && record != nil {
+			err = PassToDefaultOutputTopic(ctx, record)
+		}
+		if err != nil {
+			metricsClient.EmitCounter("aggregate_emit_error", "Number of window results failed to be emitted", 1)
+			logs.Printf("emit result of key %s in window [%v, %v) failed: %v", res.key, res.window.Start,
+				res.window.End, err)
+		}
+	}
+	metricsClient.EmitCounter("aggregate_window_result", "Number of window results", float64(len(results)))
+
+	// accumulators kept by the aggregator for windows not closed yet are saved before their buffers are deleted
+	if err := saveSnapshot(ctx, ps, aggregator.lastPane, aggregator.pending); err != nil {
+		logs.Printf("async aggregate save snapshot failed: %v", err)
+		return
+	}
+	deleteBuffers()
+}
+
+// restoreAggregator restores the accumulators kept by the aggregator of a previous run.
+func restoreAggregator(ctx context.Context, aggregator *windowAggregator, ps *paneStore) error {
+	snapshot, exists, err := loadSnapshot[*paneAccumulator](ctx, ps)
+	if err != nil || !exists {
+		return err
+	}
+	aggregator.lastPane = snapshot.PaneStart
+	aggregator.pending = append(aggregator.pending, snapshot.Pending...)
+	return nil
+}
+
+func fetchAccumulators(ctx context.Context, stateStore state.CollectionStateStore,
+	bufferId string) ([]*paneAccumulator, error) {
+
+	keys, err := stateStore.SetMembers(ctx, bufferId)
+	if err != nil {
+		return nil, err
+	}
+
+	accKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		accKeys = append(accKeys, accumulatorKey(bufferId, string(key)))
+	}
+	accs, err := state.MultiGet(ctx, stateStore, accKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*paneAccumulator, 0, len(keys))
+	for i, accKey := range accKeys {
+		accBytes, exists := accs[accKey]
+		if !exists {
+			logs.Printf("cache miss, key=%s", string(keys[i]))
+			continue
+		}
+		pa, err := state.SonicCodec[paneAccumulator]{}.Decode(accBytes)
+		if err != nil {
+			return nil, fmt.Errorf("decode accumulator of key %s failed: %v", string(keys[i]), err)
+		}
+		res = append(res, &pa)
+	}
+	return res, nil
+}
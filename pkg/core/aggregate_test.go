@@ -0,0 +1,138 @@
+package core
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/TTraveller7/invokerlib/pkg/consts"
+	"github.com/TTraveller7/invokerlib/pkg/models"
+	"github.com/TTraveller7/invokerlib/pkg/state"
+)
+
+func TestWindowAggregator_ClosePane(t *testing.T) {
+	// accumulators are strings of the timestamps added, and merging concatenates them
+	newAcc := func(key string, acc string, minTs int64, maxTs int64) *paneAccumulator {
+		return &paneAccumulator{
+			Key:   key,
+			Acc:   []byte(acc),
+			MinTs: minTs,
+			MaxTs: maxTs,
+		}
+	}
+	merge := func(a []byte, b []byte) ([]byte, error) {
+		return append(append([]byte{}, a...), b...), nil
+	}
+	type pane struct {
+		start int64
+		accs  []*paneAccumulator
+	}
+	type result struct {
+		key    string
+		window models.Window
+		acc    string
+	}
+	tests := []struct {
+		name       string
+		aggregator *windowAggregator
+		panes      []pane
+		// results of windows closed by the last pane
+		want []result
+	}{
+		{
+			name:       "tumbling",
+			aggregator: newWindowAggregator(consts.WindowTypeTumbling, 10, 0, 0, merge),
+			panes: []pane{
+				{start: 0, accs: []*paneAccumulator{newAcc("a", "1", 1, 1)}},
+				{start: 10, accs: []*paneAccumulator{newAcc("a", "2", 12, 12), newAcc("b", "3", 13, 13),
+					newAcc("a", "4", 14, 14)}},
+			},
+			want: []result{
+				{key: "a", window: models.Window{Start: 10, End: 20}, acc: "24"},
+				{key: "b", window: models.Window{Start: 10, End: 20}, acc: "3"},
+			},
+		},
+		{
+			name:       "hopping",
+			aggregator: newWindowAggregator(consts.WindowTypeHopping, 20, 10, 0, merge),
+			panes: []pane{
+				{start: 0, accs: []*paneAccumulator{newAcc("a", "1", 1, 1)}},
+				{start: 10, accs: []*paneAccumulator{newAcc("a", "2", 12, 12)}},
+				{start: 20, accs: []*paneAccumulator{newAcc("a", "3", 25, 25)}},
+			},
+			want: []result{
+				{key: "a", window: models.Window{Start: 10, End: 30}, acc: "23"},
+			},
+		},
+		{
+			name:       "session",
+			aggregator: newWindowAggregator(consts.WindowTypeSession, 0, 0, 10, merge),
+			panes: []pane{
+				{start: 0, accs: []*paneAccumulator{newAcc("a", "1", 1, 5), newAcc("b", "2", 8, 8)}},
+				{start: 10, accs: []*paneAccumulator{newAcc("a", "3", 12, 14)}},
+				{start: 20, accs: []*paneAccumulator{newAcc("b", "4", 29, 29)}},
+			},
+			// the session of b at 8 is closed with the pane ending at 20, and the session of b at 29 is still open
+			want: []result{
+				{key: "a", window: models.Window{Start: 1, End: 15}, acc: "13"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var results []*aggregateResult
+			for _, p := range tt.panes {
+				var err error
+				results, err = tt.aggregator.closePane(p.start, p.accs)
+				if err != nil {
+					t.Fatalf("closePane() error = %v", err)
+				}
+			}
+			got := make([]result, 0, len(results))
+			for _, res := range results {
+				got = append(got, result{key: res.key, window: res.window, acc: string(res.acc)})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("closePane() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWindowAggregator_Restore(t *testing.T) {
+	ctx := context.Background()
+	s, _ := state.NewFreeCacheStateStore()
+	ps, err := newPaneStore(s, "aggregate")
+	if err != nil {
+		t.Fatalf("newPaneStore() error = %v", err)
+	}
+	merge := func(a []byte, b []byte) ([]byte, error) {
+		return append(append([]byte{}, a...), b...), nil
+	}
+
+	// the session of a is still open when the processor restarts after closing the pane [10, 20)
+	aggregator := newWindowAggregator(consts.WindowTypeSession, 0, 0, 10, merge)
+	accs := []*paneAccumulator{{Key: "a", Acc: []byte("1"), MinTs: 11, MaxTs: 15}}
+	if _, err := aggregator.closePane(10, accs); err != nil {
+		t.Fatalf("closePane() error = %v", err)
+	}
+	if err := saveSnapshot(ctx, ps, aggregator.lastPane, aggregator.pending); err != nil {
+		t.Fatalf("saveSnapshot() error = %v", err)
+	}
+
+	restarted := newWindowAggregator(consts.WindowTypeSession, 0, 0, 10, merge)
+	if err := restoreAggregator(ctx, restarted, ps); err != nil {
+		t.Fatalf("restoreAggregator() error = %v", err)
+	}
+	accs = []*paneAccumulator{{Key: "a", Acc: []byte("2"), MinTs: 22, MaxTs: 24}}
+	if _, err := restarted.closePane(20, accs); err != nil {
+		t.Fatalf("closePane() error = %v", err)
+	}
+	results, err := restarted.closePane(30, []*paneAccumulator{})
+	if err != nil {
+		t.Fatalf("closePane() error = %v", err)
+	}
+	if len(results) != 1 || string(results[0].acc) != "12" || results[0].window != (models.Window{Start: 11, End: 25}) {
+		t.Errorf("closePane() = %v, want the session of a in [11, 25) with acc 12", results)
+	}
+}
@@ -1,17 +1,28 @@
 package core
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/IBM/sarama"
+	"github.com/TTraveller7/invokerlib/pkg/consts"
 	"github.com/TTraveller7/invokerlib/pkg/models"
 )
 
-var consumerGroups []sarama.ConsumerGroup
+var (
+	consumerGroups   []sarama.ConsumerGroup
+	consumerGroupsMu sync.Mutex = sync.Mutex{}
+
+	// consumerGroupsPaused is true between pauseConsumerGroups and resumeConsumerGroups
+	consumerGroupsPaused bool
+)
 
 func initConsumer() error {
 	consumerGroups = make([]sarama.ConsumerGroup, 0)
+	consumerGroupsPaused = false
 
 	return nil
 }
@@ -23,18 +34,30 @@ func defaultSaramaConsumerConfig() *sarama.Config {
 	// start consuming from the oldest offset
 	config.Consumer.Offsets.Initial = sarama.OffsetOldest
 
+	// records of aborted transactions are skipped
+	config.Consumer.IsolationLevel = sarama.ReadCommitted
+
 	config.Consumer.Return.Errors = true
 	return config
 }
 
 type workerConsumerHandler struct {
 	sarama.ConsumerGroupHandler
-	logs                *log.Logger
-	setup               func() error
-	consume             func(record *models.Record) error
-	workerNotifyChannel <-chan string
-	workerReadyChannel  chan<- struct{}
-	once                sync.Once
+	logs               *log.Logger
+	setup              func(claims map[string][]int32) error
+	claim              func(topic string, partition int32)
+	consume            func(record *models.Record, d *delivery, t *transaction) error
+	deadLetter         func(ctx context.Context, msg *sarama.ConsumerMessage, err error) error
+	newTransaction     func(topic string, partition int32) (*transaction, error)
+	workerReadyChannel chan<- struct{}
+	once               sync.Once
+}
+
+// inFlightMessage is a consumed message whose produced records may not be acknowledged yet.
+type inFlightMessage struct {
+	msg          *sarama.ConsumerMessage
+	d            *delivery
+	deadLettered bool
 }
 
 func (h *workerConsumerHandler) Setup(session sarama.ConsumerGroupSession) error {
@@ -47,13 +70,16 @@ func (h *workerConsumerHandler) Setup(session sarama.ConsumerGroupSession) error
 	})
 
 	if h.setup != nil {
-		return h.setup()
+		return h.setup(session.Claims())
 	}
 	return nil
 }
 
 func (h *workerConsumerHandler) Cleanup(session sarama.ConsumerGroupSession) error {
 	h.logs.Println("Consumer Cleanup invoked")
+
+	// commit offsets of messages marked in this session before the claims are released
+	session.Commit()
 	return nil
 }
 
@@ -62,41 +88,246 @@ func (h *workerConsumerHandler) ConsumeClaim(session sarama.ConsumerGroupSession
 
 	h.logs.Println("Consumer ConsumeClaim invoked")
 
+	// partition consumers of a session are created after Setup, so a claim is only pausable from here
+	if h.claim != nil {
+		h.claim(claim.Topic(), claim.Partition())
+	}
+
+	if h.newTransaction != nil {
+		return h.consumeClaimInTransactions(session, claim)
+	}
+
+	// messages are marked in order, after the records produced for them are acknowledged
+	inFlight := make([]*inFlightMessage, 0)
+	markCompleted := func(wait bool) error {
+		for len(inFlight) > 0 {
+			m := inFlight[0]
+			if wait {
+				<-m.d.Done()
+			} else {
+				select {
+				case <-m.d.Done():
+				default:
+					return nil
+				}
+			}
+			if err := h.completeMessage(session, m); err != nil {
+				return err
+			}
+			inFlight = inFlight[1:]
+		}
+		return nil
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
 	for {
 		select {
 		case msg, ok := <-claim.Messages():
 			if !ok {
 				h.logs.Println("Message channel closed, exiting ConsumeClaim")
-				return nil
+				return markCompleted(true)
 			}
+			d := newDelivery()
 			r := models.NewRecordWithConsumerMessage(msg)
-			if err := h.consume(r); err != nil {
+			err := h.consume(r, d, nil)
+			d.seal()
+			m := &inFlightMessage{
+				msg: msg,
+				d:   d,
+			}
+			if err != nil {
 				metricsClient.EmitCounter("consume_error", "Number of messages that are not successfully consumed", 1)
+				if err := h.sendToDeadLetter(context.Background(), msg, err); err != nil {
+					return err
+				}
+				m.deadLettered = true
+			}
+			inFlight = append(inFlight, m)
+
+			// blocks on the oldest message if too many messages are in flight
+			if err := markCompleted(len(inFlight) >= consts.MaxInFlightMessagesPerClaim); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if err := markCompleted(false); err != nil {
 				return err
 			}
-			session.MarkMessage(msg, "")
-			metricsClient.EmitCounter("consume_success", "Number of messages that are successfully consumed", 1)
-		case notify := <-h.workerNotifyChannel:
-			if notify == "exit" {
-				return ErrConsumerNotify
+		case <-session.Context().Done():
+			// the in-flight messages have been processed at this point, and are marked once acknowledged
+			h.logs.Println("Session context done, exiting ConsumeClaim")
+			return markCompleted(true)
+		}
+	}
+}
+
+// completeMessage marks a message whose delivery is done. A message with a failed delivery is handled the same
+// way as a message failing consume.
+func (h *workerConsumerHandler) completeMessage(session sarama.ConsumerGroupSession, m *inFlightMessage) error {
+	if m.deadLettered {
+		session.MarkMessage(m.msg, "")
+		metricsClient.EmitCounter("consume_dead_letter", "Number of messages that are sent to dead letter topic", 1)
+		return nil
+	}
+	if err := m.d.Err(); err != nil {
+		err = fmt.Errorf("produce records of offset %v failed: %v", m.msg.Offset, err)
+		metricsClient.EmitCounter("consume_error", "Number of messages that are not successfully consumed", 1)
+		if err := h.sendToDeadLetter(context.Background(), m.msg, err); err != nil {
+			return err
+		}
+		session.MarkMessage(m.msg, "")
+		metricsClient.EmitCounter("consume_dead_letter", "Number of messages that are sent to dead letter topic", 1)
+		return nil
+	}
+	session.MarkMessage(m.msg, "")
+	metricsClient.EmitCounter("consume_success", "Number of messages that are successfully consumed", 1)
+	return nil
+}
+
+// consumeClaimInTransactions consumes messages in transactions. Instead of being marked, the offsets of consumed
+// messages are committed with the records produced for them in one transaction.
+func (h *workerConsumerHandler) consumeClaimInTransactions(session sarama.ConsumerGroupSession,
+	claim sarama.ConsumerGroupClaim) error {
+
+	t, err := h.newTransaction(claim.Topic(), claim.Partition())
+	if err != nil {
+		err = fmt.Errorf("create transaction failed: %v", err)
+		h.logs.Printf("%v", err)
+		return err
+	}
+	defer t.close()
+	if err := t.begin(); err != nil {
+		return fmt.Errorf("begin transaction failed: %v", err)
+	}
+	commit := func() error {
+		if t.size() == 0 {
+			return nil
+		}
+		if err := t.commit(); err != nil {
+			h.logs.Printf("%v", err)
+			return err
+		}
+		if err := t.begin(); err != nil {
+			return fmt.Errorf("begin transaction failed: %v", err)
+		}
+		return nil
+	}
+
+	ticker := time.NewTicker(consts.TransactionCommitIntervalMs * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				h.logs.Println("Message channel closed, exiting ConsumeClaim")
+				return commit()
+			}
+			r := models.NewRecordWithConsumerMessage(msg)
+			deadLettered := false
+			if err := h.consume(r, nil, t); err != nil {
+				metricsClient.EmitCounter("consume_error", "Number of messages that are not successfully consumed", 1)
+				if err := h.sendToDeadLetter(withTransaction(context.Background(), t), msg, err); err != nil {
+					return err
+				}
+				t.flush()
+				deadLettered = true
+			}
+			if err := t.addMessage(msg, deadLettered); err != nil {
+				return fmt.Errorf("add offset to transaction failed: %v", err)
 			}
+			if t.size() >= consts.TransactionMaxMessages {
+				if err := commit(); err != nil {
+					return err
+				}
+			}
+		case <-ticker.C:
+			if err := commit(); err != nil {
+				return err
+			}
+		case <-session.Context().Done():
+			h.logs.Println("Session context done, exiting ConsumeClaim")
+			return commit()
 		}
 	}
 }
 
-func NewConsumerGroupHandler(logs *log.Logger, setupFunc func() error, consumeFunc func(record *models.Record) error,
-	workerNotifyChannel <-chan string, workerReadyChannel chan<- struct{}) sarama.ConsumerGroupHandler {
+// sendToDeadLetter sends the failed message to dead letter topic. It returns err if the message cannot be sent.
+// If ctx does not carry a transaction, it returns after the dead letter record is acknowledged.
+func (h *workerConsumerHandler) sendToDeadLetter(ctx context.Context, msg *sarama.ConsumerMessage, err error) error {
+	if h.deadLetter == nil {
+		return err
+	}
+	if dlqErr := h.deadLetter(ctx, msg, err); dlqErr != nil {
+		h.logs.Printf("send message to dead letter topic failed: %v", dlqErr)
+		return err
+	}
+	return nil
+}
+
+// NewConsumerGroupHandler creates a consumer group handler. setupFunc is called with the claims of each session
+// before any claim is consumed, and claimFunc is called with the topic and partition of each claim before its
+// messages are consumed. If deadLetterFunc is nil, a message failing consumeFunc
+// ends the consumer group session without being marked. If newTransactionFunc is not nil, messages are consumed
+// in transactions.
+func NewConsumerGroupHandler(logs *log.Logger, setupFunc func(claims map[string][]int32) error,
+	claimFunc func(topic string, partition int32),
+	consumeFunc func(record *models.Record, d *delivery, t *transaction) error,
+	deadLetterFunc func(ctx context.Context, msg *sarama.ConsumerMessage, err error) error,
+	newTransactionFunc func(topic string, partition int32) (*transaction, error),
+	workerReadyChannel chan<- struct{}) sarama.ConsumerGroupHandler {
 
 	return &workerConsumerHandler{
-		logs:                logs,
-		setup:               setupFunc,
-		consume:             consumeFunc,
-		workerNotifyChannel: workerNotifyChannel,
-		workerReadyChannel:  workerReadyChannel,
+		logs:               logs,
+		setup:              setupFunc,
+		claim:              claimFunc,
+		consume:            consumeFunc,
+		deadLetter:         deadLetterFunc,
+		newTransaction:     newTransactionFunc,
+		workerReadyChannel: workerReadyChannel,
+	}
+}
+
+func addConsumerGroup(grp sarama.ConsumerGroup) {
+	consumerGroupsMu.Lock()
+	defer consumerGroupsMu.Unlock()
+	consumerGroups = append(consumerGroups, grp)
+}
+
+// pauseConsumerGroups stops all consumer groups from fetching. The consumer groups keep sending
+// heartbeats, so the workers stay in their groups and keep their partition claims.
+func pauseConsumerGroups() {
+	consumerGroupsMu.Lock()
+	defer consumerGroupsMu.Unlock()
+	consumerGroupsPaused = true
+	for _, grp := range consumerGroups {
+		grp.PauseAll()
+	}
+}
+
+// pauseClaimIfPaused pauses a partition claimed by grp if the consumer groups are paused. It returns true if the
+// partition is paused.
+func pauseClaimIfPaused(grp sarama.ConsumerGroup, topic string, partition int32) bool {
+	consumerGroupsMu.Lock()
+	defer consumerGroupsMu.Unlock()
+	if !consumerGroupsPaused {
+		return false
+	}
+	grp.Pause(map[string][]int32{topic: {partition}})
+	return true
+}
+
+func resumeConsumerGroups() {
+	consumerGroupsMu.Lock()
+	defer consumerGroupsMu.Unlock()
+	consumerGroupsPaused = false
+	for _, grp := range consumerGroups {
+		grp.ResumeAll()
 	}
 }
 
 func closeConsumerGroup() {
+	consumerGroupsMu.Lock()
+	defer consumerGroupsMu.Unlock()
 	for _, grp := range consumerGroups {
 		grp.Close()
 	}
@@ -33,10 +33,12 @@ var (
 
 	metricsClient *utils.MetricsClient
 
-	workerMetas  map[string]*WorkerMeta
-	workerMetaMu sync.RWMutex = sync.RWMutex{}
+	cronDone      chan<- bool
+	processorCron *Cron
 
-	cronDone chan<- bool
+	// processorStateStore is the state store of the processor backed by its changelog, if it has one
+	processorStateStore state.StateStore
+	changelogStateStore *state.ChangelogStateStore
 
 	logs *log.Logger = log.New(os.Stdout, "", log.LstdFlags|log.Lshortfile)
 )
@@ -69,7 +71,6 @@ func Initialize(internalPc *conf.InternalProcessorConfig, pc *models.ProcessorCa
 	metricsClient = utils.NewMetricsClient(c.Name)
 
 	processorCtx = context.Background()
-	workerMetas = make(map[string]*WorkerMeta, 0)
 	workerNotifyChannels = make([]chan<- string, 0)
 	workerErrorChannels = make([]<-chan error, 0)
 	wg = &sync.WaitGroup{}
@@ -88,14 +89,55 @@ func Initialize(internalPc *conf.InternalProcessorConfig, pc *models.ProcessorCa
 			return err
 		}
 	case consts.ProcessorTypeJoin:
-		if pc.Join == nil {
+		if pc.Join == nil && pc.MultiJoin == nil {
 			err = fmt.Errorf("join in processor callbacks is not specified")
 			logs.Printf("%v", err)
 			return err
 		}
+		if pc.Join != nil && pc.MultiJoin != nil {
+			err = fmt.Errorf("only one of join and multi join in processor callbacks can be specified")
+			logs.Printf("%v", err)
+			return err
+		}
+		if pc.MultiJoin == nil && len(c.ConsumerConfigs) != 2 {
+			err = fmt.Errorf("multi join in processor callbacks must be specified for a join with %v inputs",
+				len(c.ConsumerConfigs))
+			logs.Printf("%v", err)
+			return err
+		}
+		for topic := range pc.JoinKeyExtractors {
+			isInput := false
+			for _, cc := range c.ConsumerConfigs {
+				isInput = isInput || cc.Topic == topic
+			}
+			if !isInput {
+				err = fmt.Errorf("join key extractor is specified for topic %s, which is not an input", topic)
+				logs.Printf("%v", err)
+				return err
+			}
+			if isTableInput(c, topic) {
+				err = fmt.Errorf("join key extractor is specified for table %s, which is joined by record key", topic)
+				logs.Printf("%v", err)
+				return err
+			}
+		}
+	case consts.ProcessorTypeAggregate:
+		ac := pc.Aggregate
+		if ac == nil || ac.Init == nil || ac.Add == nil || ac.Merge == nil || ac.Emit == nil {
+			err = fmt.Errorf("aggregate in processor callbacks is not fully specified")
+			logs.Printf("%v", err)
+			return err
+		}
 	default:
 		return consts.ErrProcessorTypeNotRecognized
 	}
+	for topic, partitioner := range c.Partitioners {
+		if partitioner.Type == consts.PartitionerTypeCallback && pc.Partitioner == nil {
+			err = fmt.Errorf("partitioner in processor callbacks is not specified for output topic %s", topic)
+			logs.Printf("%v", err)
+			return err
+		}
+	}
 	processorCallbacks = pc
 
 	// init consumer
@@ -114,6 +156,16 @@ func Initialize(internalPc *conf.InternalProcessorConfig, pc *models.ProcessorCa
 	}
 	logs.Printf("producers start")
 
+	// back the state store with its changelog before OnInit, which may write it
+	if c.ChangelogKafkaConfig != nil {
+		if err := initChangelogStateStore(); err != nil {
+			err = fmt.Errorf("init changelog state store failed: %v", err)
+			logs.Printf("%v", err)
+			return err
+		}
+		logs.Printf("state store %s is backed by changelog %s", c.StateStore, c.ChangelogKafkaConfig.Topic)
+	}
+
 	// call OnInit if user has one
 	if processorCallbacks.OnInit != nil {
 		if err := doOnInit(processorCallbacks.OnInit); err != nil {
@@ -156,7 +208,10 @@ func Run() error {
 	c := conf.Config()
 	workerTotalCount := 0
 	for _, consumerConfig := range c.ConsumerConfigs {
-		workerTotalCount += consumerConfig.NumOfWorkers
+		// tables are not consumed by workers
+		if !consumerConfig.Table {
+			workerTotalCount += consumerConfig.NumOfWorkers
+		}
 	}
 	workerReadyChannels = make([]<-chan struct{}, workerTotalCount)
 
@@ -174,27 +229,132 @@ func Run() error {
 				workerReadyChannel := make(chan struct{}, 1)
 				workerReadyChannels = append(workerReadyChannels, workerReadyChannel)
 
+				wg.Add(1)
 				go Work(workerCtx, consumerConfig, i, processorCallbacks.Process, workerErrorChannel, wg, workerNotifyChannel, workerReadyChannel)
 
+				metricsClient.EmitCounter("worker_num", "Number of workers", 1)
+			}
+		}
+	} else if isTableJoin(c) {
+		stateStoreWrapper, err := newProcessorStateStore(c.StateStore)
+		if err != nil {
+			logs.Printf("create state store %s failed: %v", c.StateStore, err)
+			return err
+		}
+
+		// records of the stream input are joined as they arrive, after the tables are loaded
+		tj, err := startTableJoiner(processorCtx, c, stateStoreWrapper)
+		if err != nil {
+			logs.Printf("start table joiner failed: %v", err)
+			return err
+		}
+		for _, consumerConfig := range c.ConsumerConfigs {
+			if consumerConfig.Table {
+				continue
+			}
+			for i := 0; i < consumerConfig.NumOfWorkers; i++ {
+				workerCtx := utils.NewWorkerContext(processorCtx, i, c.Name, consumerConfig.Topic)
+
+				workerNotifyChannel := make(chan string, 10)
+				workerNotifyChannels = append(workerNotifyChannels, workerNotifyChannel)
+
+				workerErrorChannel := make(chan error, 1)
+				workerErrorChannels = append(workerErrorChannels, workerErrorChannel)
+
+				workerReadyChannel := make(chan struct{}, 1)
+				workerReadyChannels = append(workerReadyChannels, workerReadyChannel)
+
+				wg.Add(1)
+				go Work(workerCtx, consumerConfig, i, tj.process, workerErrorChannel, wg, workerNotifyChannel,
+					workerReadyChannel)
+
 				metricsClient.EmitCounter("worker_num", "Number of workers", 1)
 			}
 		}
 	} else {
-		windowSize := int64(c.WindowSize)
-		w := NewWatermark(windowSize)
+		stateStoreWrapper, err := newProcessorStateStore(c.StateStore)
+		if err != nil {
+			logs.Printf("create state store %s failed: %v", c.StateStore, err)
+			return err
+		}
+		ps, err := newPaneStore(stateStoreWrapper, c.Name)
+		if err != nil {
+			logs.Printf("create pane store failed: %v", err)
+			return err
+		}
 
-		cd := make(chan bool)
-		cronDone = cd
-		cronCtx := context.WithValue(processorCtx, consts.CTX_KEY_INVOKER_LIB_CRON, "cron")
-		cron := NewCron(1*time.Second, windowSize, w, cd)
-		stateStore, err := state.NewRedisStateStore("state-redis")
+		// join and aggregate processors buffer records in panes, which are closed by the cron
+		var paneSize int64
+		var closePaneFunc func(ctx context.Context, paneStart int64)
+		if c.Type == consts.ProcessorTypeAggregate {
+			aggregator := newWindowAggregator(c.WindowType, int64(c.WindowSize), int64(c.WindowSlide),
+				int64(c.SessionGap), processorCallbacks.Aggregate.Merge)
+			paneSize = aggregator.paneSize()
+			if err := restoreAggregator(processorCtx, aggregator, ps); err != nil {
+				logs.Printf("restore aggregator failed: %v", err)
+				return err
+			}
+			closePaneFunc = func(ctx context.Context, paneStart int64) {
+				asyncAggregate(ctx, paneStart, aggregator, processorCallbacks.Aggregate, ps)
+			}
+		} else {
+			keyFunc := joinKeyOf
+			if c.CrossJoin {
+				keyFunc = crossJoinKey
+			}
+			var joiner *windowJoiner
+			if c.WindowType == consts.WindowTypeInterval {
+				joiner = newIntervalJoiner(int64(c.IntervalLower), int64(c.IntervalUpper), keyFunc)
+			} else {
+				joiner = newWindowJoiner(c.WindowType, int64(c.WindowSize), int64(c.WindowSlide),
+					int64(c.SessionGap), keyFunc)
+			}
+			paneSize = joiner.paneSize()
+			if err := restoreJoiner(processorCtx, joiner, ps); err != nil {
+				logs.Printf("restore joiner failed: %v", err)
+				return err
+			}
+			joinCallback := multiJoinCallback(processorCallbacks)
+			closePaneFunc = func(ctx context.Context, paneStart int64) {
+				asyncJoin(ctx, paneStart, joiner, joinCallback, ps)
+			}
+		}
+
+		// the watermark advances by panes
+		var w *Watermark
+		if c.TimeMode == consts.TimeModeEventTime {
+			w = NewEventTimeWatermark(paneSize, int64(c.MaxOutOfOrderness), int64(c.AllowedLateness))
+		} else {
+			w = NewWatermark(paneSize)
+		}
+
+		// panes left open by a previous run are closed before the panes of this run
+		recoveredPanes, err := ps.recover(processorCtx, w)
 		if err != nil {
-			logs.Printf("create redis state store failed: %v", err)
+			logs.Printf("recover panes failed: %v", err)
 			return err
 		}
-		stateStoreWrapper := state.NewStateStoreWrapper(stateStore, metricsClient)
-		go cron.run(cronCtx, processorCallbacks.Join, stateStoreWrapper)
+		if len(recoveredPanes) > 0 {
+			logs.Printf("recovered %v open panes", len(recoveredPanes))
+		}
 
+		cd := make(chan bool)
+		cronDone = cd
+		cronCtx := context.WithValue(processorCtx, consts.CTX_KEY_INVOKER_LIB_CRON, "cron")
+		cron := NewCron(1*time.Second, w, cd)
+		cron.recover(recoveredPanes)
+		processorCron = cron
+		go cron.run(cronCtx, func(ctx context.Context, paneStart int64) {
+			closePaneFunc(ctx, paneStart)
+			if err := ps.close(ctx, paneStart, paneStart+paneSize); err != nil {
+				logs.Printf("close pane %v failed: %v", paneStart, err)
+			}
+		})
+
+		expireTime := c.StateRetention
+		if expireTime == 0 {
+			expireTime = 5*int(paneSize) + c.MaxOutOfOrderness + c.AllowedLateness
+		}
 		for _, consumerConfig := range c.ConsumerConfigs {
 			for i := 0; i < consumerConfig.NumOfWorkers; i++ {
 				workerCtx := utils.NewWorkerContext(processorCtx, i, c.Name, consumerConfig.Topic)
@@ -208,9 +368,18 @@ func Run() error {
 				workerReadyChannel := make(chan struct{}, 1)
 				workerReadyChannels = append(workerReadyChannels, workerReadyChannel)
 
-				joinWorker := NewJoinWorker(w, stateStoreWrapper, int(5*windowSize))
-				go Work(workerCtx, consumerConfig, i, joinWorker.JoinWorkerProcessCallback, workerErrorChannel, wg,
-					workerNotifyChannel, workerReadyChannel)
+				var processFunc models.ProcessCallback
+				if c.Type == consts.ProcessorTypeAggregate {
+					aggregateWorker := NewAggregateWorker(w, ps, consumerConfig.TopicIndex, expireTime,
+						processorCallbacks.Aggregate)
+					processFunc = aggregateWorker.AggregateWorkerProcessCallback
+				} else {
+					joinWorker := NewJoinWorker(w, ps, consumerConfig.TopicIndex, expireTime)
+					processFunc = joinWorker.JoinWorkerProcessCallback
+				}
+				wg.Add(1)
+				go Work(workerCtx, consumerConfig, i, processFunc, workerErrorChannel, wg, workerNotifyChannel,
+					workerReadyChannel)
 
 				metricsClient.EmitCounter("worker_num", "Number of workers", 1)
 			}
@@ -227,7 +396,9 @@ func Run() error {
 			hasReset = true
 
 			// stop workers, close producers and consumer group
-			Exit()
+			if exitErr := Exit(); exitErr != nil {
+				logs.Printf("exit failed: %v", exitErr)
+			}
 
 			return fmt.Errorf("start worker #%v failed: %v", i, workerErr)
 		default:
@@ -242,23 +413,148 @@ func Run() error {
 		return err
 	}
 
+	// exit gracefully when the pod is terminated
+	handleSignals()
+
 	return nil
 }
 
-func Exit() {
+// initChangelogStateStore creates the state store of the processor backed by its changelog. Partitions of the
+// changelog are restored by the workers that claim the input partitions with the same numbers.
+func initChangelogStateStore() error {
+	c := conf.Config()
+	local, err := state.NewStateStore(c.StateStore)
+	if err != nil {
+		return err
+	}
+	cs, err := state.NewChangelogStateStore(local, c.ChangelogKafkaConfig)
+	if err != nil {
+		return err
+	}
+	changelogStateStore = cs
+	processorStateStore = state.NewNamespacedStateStore(cs, state.Namespace(c.PipelineName, c.Name, c.StateStore))
+	state.AddStateStore(c.StateStore, processorStateStore)
+	return nil
+}
+
+// restoreChangelogPartitions restores the changelog partitions of input partitions claimed by a worker, if the
+// state store of the processor is backed by a changelog.
+func restoreChangelogPartitions(ctx context.Context, partitions []int32) error {
+	if changelogStateStore == nil || len(partitions) == 0 {
+		return nil
+	}
+	if err := changelogStateStore.Restore(ctx, partitions); err != nil {
+		return fmt.Errorf("restore changelog partitions %v failed: %v", partitions, err)
+	}
+	logs.Printf("changelog partitions %v are restored", partitions)
+	return nil
+}
+
+func closeChangelogStateStore() {
+	if changelogStateStore == nil {
+		return
+	}
+	if err := changelogStateStore.Close(); err != nil {
+		logs.Printf("close changelog state store failed: %v", err)
+	}
+	changelogStateStore = nil
+	processorStateStore = nil
+}
+
+// newProcessorStateStore creates the state store with name, with keys in the namespace of the processor. The
+// state store is registered to be shown by cat, unless OnInit registers one with the same name. The state store
+// backed by the changelog is used if name is the state store of the processor.
+func newProcessorStateStore(name string) (*state.StateStoreWrapper, error) {
+	if processorStateStore != nil && name == conf.Config().StateStore {
+		return state.NewStateStoreWrapper(processorStateStore, metricsClient), nil
+	}
+	stateStore, err := state.NewProcessorStateStore(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := state.StateStores()[name]; !exists {
+		state.AddStateStore(name, stateStore)
+	}
+	return state.NewStateStoreWrapper(stateStore, metricsClient), nil
+}
+
+func Pause() error {
+	resetFunc, transitionErr := startTransition(functionStates.Paused)
+	if transitionErr != nil {
+		return fmt.Errorf("start transition failed: %v", transitionErr)
+	}
+	defer resetFunc()
+
+	// stop fetching without leaving consumer groups
+	pauseConsumerGroups()
+	logs.Printf("all consumer groups are paused")
+
+	// stop closing panes, which would emit joins and aggregates while paused
+	if processorCron != nil {
+		processorCron.pause()
+	}
+
+	if transitionErr := transitToPaused(); transitionErr != nil {
+		if processorCron != nil {
+			processorCron.resume()
+		}
+		resumeConsumerGroups()
+		err := fmt.Errorf("transit to paused failed: %v", transitionErr)
+		logs.Printf("%v", err)
+		return err
+	}
+	return nil
+}
+
+func Resume() error {
+	resetFunc, transitionErr := startTransition(functionStates.Running)
+	if transitionErr != nil {
+		return fmt.Errorf("start transition failed: %v", transitionErr)
+	}
+	defer resetFunc()
+
+	if state, _ := getState(); state != functionStates.Paused {
+		return fmt.Errorf("processor is not paused: state=%s", state)
+	}
+
+	resumeConsumerGroups()
+	logs.Printf("all consumer groups are resumed")
+	if processorCron != nil {
+		processorCron.resume()
+	}
+
+	if transitionErr := transitToRunning(); transitionErr != nil {
+		if processorCron != nil {
+			processorCron.pause()
+		}
+		pauseConsumerGroups()
+		err := fmt.Errorf("transit to running failed: %v", transitionErr)
+		logs.Printf("%v", err)
+		return err
+	}
+	return nil
+}
+
+// Exit stops the processor gracefully. Workers finish processing their in-flight records and commit the
+// offsets of processed records before leaving their consumer groups. Pending window joins are waited for,
+// producers are flushed and closed, and OnExit is called at last.
+func Exit() error {
 	resetFunc, transitionErr := startTransition(functionStates.Exited)
 	if transitionErr != nil {
-		logs.Printf("start transition failed: %v", transitionErr)
-		return
+		err := fmt.Errorf("start transition failed: %v", transitionErr)
+		logs.Printf("%v", err)
+		return err
 	}
 	defer resetFunc()
+	logs.Printf("exit starts")
 
 	// stop cron
 	if cronDone != nil {
 		close(cronDone)
+		cronDone = nil
 	}
 
-	// stop workers
+	// stop workers and wait for in-flight records to be drained
 	for _, nc := range workerNotifyChannels {
 		nc <- "exit"
 	}
@@ -268,25 +564,47 @@ func Exit() {
 			logs.Printf("worker exited with error: %v", err)
 		}
 	}
+	logs.Printf("all workers exited")
+
+	// wait for pending joins, which may still produce records
+	if processorCron != nil {
+		processorCron.wait()
+	}
+
+	// stop following tables
+	closeTables()
+
+	// stop sending to the changelog
+	closeChangelogStateStore()
 
 	// stop consumer group
 	closeConsumerGroup()
 
-	// stop producers
+	// flush and stop producers
 	closeProducers()
 
 	// call OnExit if user has one
 	if processorCallbacks.OnExit != nil {
-		processorCallbacks.OnExit()
+		if err := doOnExit(processorCallbacks.OnExit); err != nil {
+			logs.Printf("user callback OnExit failed: %v", err)
+		}
 	}
 
 	if transitionErr := transitToExited(); transitionErr != nil {
-		logs.Printf("transit to exited failed: %v", transitionErr)
+		err := fmt.Errorf("transit to exited failed: %v", transitionErr)
+		logs.Printf("%v", err)
+		return err
 	}
+	logs.Printf("exit finished")
+	return nil
 }
 
-func addWorkerMeta(wm *WorkerMeta) {
-	workerMetaMu.Lock()
-	defer workerMetaMu.Unlock()
-	workerMetas[wm.WorkerId] = wm
+func doOnExit(OnExit models.ExitCallback) (err error) {
+	defer func() {
+		if panicErr := recover(); panicErr != nil {
+			err = fmt.Errorf("%v. %s", panicErr, string(debug.Stack()))
+		}
+	}()
+	OnExit()
+	return
 }
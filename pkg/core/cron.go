@@ -5,47 +5,90 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/TTraveller7/invokerlib/pkg/consts"
+	"github.com/TTraveller7/invokerlib/pkg/conf"
 	"github.com/TTraveller7/invokerlib/pkg/models"
 	"github.com/TTraveller7/invokerlib/pkg/state"
-	"github.com/TTraveller7/invokerlib/pkg/utils"
-	"github.com/bytedance/sonic"
 )
 
 type Cron struct {
 	t            time.Ticker
 	done         <-chan bool
 	w            *Watermark
-	windowSize   int64
 	tickInterval time.Duration
 	available    bool
 	logs         *log.Logger
+
+	// paused stops the watermark from advancing, so no pane is closed while the processor is paused
+	paused atomic.Bool
+
+	// panes sends closed panes to the goroutine closing them in order. joins tracks the goroutine, and stopped is
+	// closed when run returns.
+	panes   chan int64
+	joins   sync.WaitGroup
+	stopped chan struct{}
+
+	// recovered are panes left open by a previous run, which are closed before other panes
+	recovered []int64
 }
 
-func NewCron(tickInterval time.Duration, windowSize int64, w *Watermark, done <-chan bool) *Cron {
+func NewCron(tickInterval time.Duration, w *Watermark, done <-chan bool) *Cron {
 	ticker := time.NewTicker(tickInterval)
 	return &Cron{
 		t:            *ticker,
 		done:         done,
 		w:            w,
-		windowSize:   windowSize,
 		tickInterval: tickInterval,
 		available:    true,
 		logs:         log.New(os.Stdout, "cron", log.LstdFlags|log.Lshortfile),
+		panes:        make(chan int64, 16),
+		stopped:      make(chan struct{}),
 	}
 }
 
-func (c *Cron) run(ctx context.Context, joinCallback models.JoinCallback, stateStore state.StateStore) {
+// pause stops closing panes until resume is called.
+func (c *Cron) pause() {
+	c.paused.Store(true)
+}
+
+func (c *Cron) resume() {
+	c.paused.Store(false)
+}
+
+// recover makes run close panes before the panes closed by the watermark. It must be called before run.
+func (c *Cron) recover(panes []int64) {
+	c.recovered = panes
+}
+
+// run advances the watermark, and calls closePane with the start of each pane that is closed.
+func (c *Cron) run(ctx context.Context, closePane func(ctx context.Context, paneStart int64)) {
+	if !c.available {
+		panic("cron can only be run once")
+	}
+
+	// panes are closed one by one, since records of a pane may belong to windows with the following panes
+	c.joins.Add(1)
+	go func() {
+		defer c.joins.Done()
+		for _, paneStart := range c.recovered {
+			c.logs.Printf("close recovered pane %v", paneStart)
+			closePane(ctx, paneStart)
+		}
+		for paneStart := range c.panes {
+			closePane(ctx, paneStart)
+		}
+	}()
+
 	defer func() {
 		c.t.Stop()
 		c.available = false
+		close(c.panes)
+		close(c.stopped)
 	}()
-	if !c.available {
-		panic("cron can only be run once")
-	}
-	for c.w.Get()+c.windowSize < time.Now().Unix() {
+	for c.w.ShouldAdvance(time.Now().Unix()) {
 		c.w.Advance()
 	}
 	for {
@@ -57,18 +100,31 @@ func (c *Cron) run(ctx context.Context, joinCallback models.JoinCallback, stateS
 			c.logs.Printf("cron exits by context done")
 			return
 		case ts := <-c.t.C:
-			watermark := c.w.Get()
-			if watermark+c.windowSize < ts.Unix() {
+			if c.paused.Load() {
+				continue
+			}
+			// in event time mode, more than one pane can be closed in a tick when replaying a topic
+			for c.w.ShouldAdvance(ts.Unix()) {
+				watermark := c.w.Get()
 				c.w.Advance()
-				go asyncJoin(ctx, watermark, joinCallback, stateStore)
-				c.logs.Printf("watermark advanced: %v to %v", watermark, watermark+c.windowSize)
+				c.panes <- watermark
+				c.logs.Printf("watermark advanced: %v to %v", watermark, c.w.Get())
 			}
 		}
 	}
 }
 
-func asyncJoin(ctx context.Context, watermark int64, joinCallback models.JoinCallback, stateStore state.StateStore) {
-	asyncJoinPrefix := fmt.Sprintf("[async join at %v] ", watermark)
+// wait blocks until the cron stops and all panes it closed are processed.
+func (c *Cron) wait() {
+	<-c.stopped
+	c.joins.Wait()
+}
+
+// asyncJoin loads the records of the pane starting at paneStart, and joins the windows closed with the pane.
+func asyncJoin(ctx context.Context, paneStart int64, joiner *windowJoiner, joinCallback models.MultiJoinCallback,
+	ps *paneStore) {
+
+	asyncJoinPrefix := fmt.Sprintf("[async join at %v] ", paneStart)
 	logs := log.New(os.Stdout, asyncJoinPrefix, log.LstdFlags|log.Lshortfile)
 	startTime := time.Now()
 	defer func() {
@@ -77,118 +133,83 @@ func asyncJoin(ctx context.Context, watermark int64, joinCallback models.JoinCal
 			float64(elapsedTime))
 	}()
 
-	leftBatchIds := make([]string, 0)
-	rightBatchIds := make([]string, 0)
-	workerMetaMu.RLock()
-	defer workerMetaMu.RUnlock()
-	for _, workerMeta := range workerMetas {
-		batchId := utils.BatchIdFromWorkerId(workerMeta.WorkerId, watermark)
-		if workerMeta.TopicIndex == 0 {
-			leftBatchIds = append(leftBatchIds, batchId)
-		} else {
-			rightBatchIds = append(rightBatchIds, batchId)
-		}
-	}
-	defer func() {
-		for _, batchId := range leftBatchIds {
-			if err := stateStore.Delete(ctx, batchId); err != nil {
-				logs.Printf("async join delete keySet record failed: %v", err)
-			}
-		}
-		for _, batchId := range rightBatchIds {
-			if err := stateStore.Delete(ctx, batchId); err != nil {
-				logs.Printf("async join delete keySet record failed: %v", err)
-			}
-		}
-	}()
-
-	// fetch key sets
-	leftKeySets, err := fetchKeySets(ctx, stateStore, leftBatchIds)
+	// fetch the records of each buffer in the pane
+	numInputs := len(conf.Config().ConsumerConfigs)
+	records := make([]*windowRecord, 0)
+	inputCounts := make([]int, numInputs)
+	buffers, err := ps.buffers(ctx, paneStart)
 	if err != nil {
-		logs.Printf("async join fetch key sets failed: %v", err)
+		logs.Printf("async join fetch buffers failed: %v", err)
 		return
 	}
-	defer func() {
-		for _, key := range leftKeySets {
-			if err := stateStore.Delete(ctx, key); err != nil {
-				logs.Printf("async join delete left record failed: %v", err)
-			}
+	deleteBuffers := func() {
+		bufferIds := make([]string, 0, len(buffers))
+		for _, pb := range buffers {
+			bufferIds = append(bufferIds, pb.Id)
 		}
-	}()
-	rightKeySets, err := fetchKeySets(ctx, stateStore, rightBatchIds)
-	if err != nil {
-		logs.Printf("async join fetch key sets failed: %v", err)
+		if err := state.MultiDelete(ctx, ps.s, bufferIds); err != nil {
+			logs.Printf("async join delete buffered records failed: %v", err)
+		}
+	}
+	if paneStart <= joiner.lastPane {
+		// the pane was joined by a previous run, which stopped before closing it in the pane store
+		deleteBuffers()
 		return
 	}
-	defer func() {
-		for _, key := range rightKeySets {
-			if err := stateStore.Delete(ctx, key); err != nil {
-				logs.Printf("async join delete right record failed: %v", err)
-			}
+	for _, pb := range buffers {
+		bufferRecords, err := fetchBufferedRecords(ctx, ps.s, pb)
+		if err != nil {
+			logs.Printf("async join fetch buffered records failed: %v", err)
+			return
 		}
-	}()
-
-	// fetch records
-	leftRecords, err := fetchRecords(ctx, stateStore, leftKeySets)
-	if err != nil {
-		logs.Printf("async join fetch records failed: %v", err)
+		records = append(records, bufferRecords...)
+		inputCounts[pb.TopicIndex] += len(bufferRecords)
 	}
 
 	// join
-	for _, rightKey := range rightKeySets {
-		val, err := stateStore.Get(ctx, rightKey)
-		if err == consts.ErrStateStoreKeyNotExist {
-			logs.Printf("cache miss, key=%s", rightKey)
-			continue
-		} else if err != nil {
-			logs.Printf("async join fetch record failed: %v", err)
-			continue
+	for _, w := range joiner.closePane(paneStart, records, numInputs) {
+		if err := windowJoin(ctx, w, conf.Config().JoinType, joiner.keyFunc, joinCallback); err != nil {
+			logs.Printf("async join: %v", err)
+			return
 		}
+	}
 
-		rightRecord := models.NewRecord(rightKey, val)
-		for _, leftRecord := range leftRecords {
-			if err := joinCallback(ctx, leftRecord, rightRecord); err != nil {
-				logs.Printf("async join: join callback failed: %v", err)
-				return
-			}
-		}
+	// records kept by the joiner for windows not closed yet are saved before their buffers are deleted
+	if err := saveJoinSnapshot(ctx, joiner, ps); err != nil {
+		logs.Printf("async join save snapshot failed: %v", err)
+		return
+	}
+	deleteBuffers()
+	rightCount := 0
+	for _, count := range inputCounts[1:] {
+		rightCount += count
 	}
 	metricsClient.EmitCounter("window_join_left_record", "Number of left records in a window",
-		float64(len(leftKeySets)))
+		float64(inputCounts[0]))
 	metricsClient.EmitCounter("window_join_right_record", "Number of right records in a window",
-		float64(len(rightKeySets)))
+		float64(rightCount))
 }
 
-func fetchKeySets(ctx context.Context, stateStore state.StateStore, batchIds []string) ([]string, error) {
-	res := make([]string, 0)
-	for _, batchId := range batchIds {
-		keySet, err := stateStore.Get(ctx, batchId)
-		if err == consts.ErrStateStoreKeyNotExist {
-			logs.Printf("cache miss, batchId=%s", batchId)
-			continue
-		} else if err != nil {
-			return nil, err
-		}
-
-		keySetArr := make([]string, 0)
-		sonic.Unmarshal(keySet, &keySetArr)
-		res = append(res, keySetArr...)
+func saveJoinSnapshot(ctx context.Context, joiner *windowJoiner, ps *paneStore) error {
+	pending := make([]*snapshotRecord, 0, len(joiner.pending))
+	for _, wr := range joiner.pending {
+		pending = append(pending, &snapshotRecord{
+			Record:     toBufferedRecord(wr.record, wr.timestamp),
+			TopicIndex: wr.topicIndex,
+		})
 	}
-	return res, nil
+	return saveSnapshot(ctx, ps, joiner.lastPane, pending)
 }
 
-func fetchRecords(ctx context.Context, stateStore state.StateStore, keySet []string) ([]*models.Record, error) {
-	res := make([]*models.Record, 0, len(keySet))
-	for _, key := range keySet {
-		val, err := stateStore.Get(ctx, key)
-		if err == consts.ErrStateStoreKeyNotExist {
-			logs.Printf("cache miss, key=%s", key)
-			continue
-		} else if err != nil {
-			return nil, err
-		}
-
-		res = append(res, models.NewRecord(key, val))
+// restoreJoiner restores the records kept by the joiner of a previous run.
+func restoreJoiner(ctx context.Context, joiner *windowJoiner, ps *paneStore) error {
+	snapshot, exists, err := loadSnapshot[*snapshotRecord](ctx, ps)
+	if err != nil || !exists {
+		return err
+	}
+	joiner.lastPane = snapshot.PaneStart
+	for _, sr := range snapshot.Pending {
+		joiner.pending = append(joiner.pending, sr.Record.toWindowRecord(sr.TopicIndex))
 	}
-	return res, nil
+	return nil
 }
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/IBM/sarama"
+	"github.com/TTraveller7/invokerlib/pkg/conf"
+	"github.com/TTraveller7/invokerlib/pkg/consts"
+)
+
+// sendToDeadLetter sends a message that fails processing to the dead letter topic. The original key, value and
+// headers are kept, and headers describing the failure are appended. If ctx carries a transaction, the dead letter
+// record is sent in the transaction.
+func sendToDeadLetter(ctx context.Context, msg *sarama.ConsumerMessage, processErr error) error {
+	if dlp == nil {
+		return fmt.Errorf("processor does not have dead letter topic producer")
+	}
+
+	stackTrace := ""
+	var pe *panicError
+	if errors.As(processErr, &pe) {
+		stackTrace = string(pe.stack)
+	}
+
+	dlqHeaders := [][2]string{
+		{consts.DeadLetterHeaderError, processErr.Error()},
+		{consts.DeadLetterHeaderStackTrace, stackTrace},
+		{consts.DeadLetterHeaderProcessor, conf.Config().Name},
+		{consts.DeadLetterHeaderSourceTopic, msg.Topic},
+		{consts.DeadLetterHeaderSourcePartition, strconv.FormatInt(int64(msg.Partition), 10)},
+		{consts.DeadLetterHeaderSourceOffset, strconv.FormatInt(msg.Offset, 10)},
+	}
+	headers := make([]sarama.RecordHeader, 0, len(msg.Headers)+len(dlqHeaders))
+	for _, h := range msg.Headers {
+		headers = append(headers, *h)
+	}
+	for _, h := range dlqHeaders {
+		headers = append(headers, sarama.RecordHeader{
+			Key:   []byte(h[0]),
+			Value: []byte(h[1]),
+		})
+	}
+
+	dlqMsg := &sarama.ProducerMessage{
+		Value:     sarama.ByteEncoder(msg.Value),
+		Headers:   headers,
+		Timestamp: msg.Timestamp,
+	}
+	if msg.Key != nil {
+		dlqMsg.Key = sarama.ByteEncoder(msg.Key)
+	}
+	return dlp.produce(ctx, dlqMsg)
+}
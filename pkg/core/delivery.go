@@ -0,0 +1,76 @@
+package core
+
+import (
+	"context"
+	"sync"
+
+	"github.com/TTraveller7/invokerlib/pkg/consts"
+)
+
+// delivery tracks the records produced while processing one consumed record. It is done when the record is
+// processed and all records produced are acknowledged.
+type delivery struct {
+	mu      sync.Mutex
+	pending int
+	sealed  bool
+	err     error
+	done    chan struct{}
+}
+
+func newDelivery() *delivery {
+	return &delivery{
+		done: make(chan struct{}),
+	}
+}
+
+func withDelivery(ctx context.Context, d *delivery) context.Context {
+	return context.WithValue(ctx, consts.CTX_KEY_INVOKER_LIB_DELIVERY, d)
+}
+
+func deliveryFromContext(ctx context.Context) *delivery {
+	d, _ := ctx.Value(consts.CTX_KEY_INVOKER_LIB_DELIVERY).(*delivery)
+	return d
+}
+
+func (d *delivery) add() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pending++
+}
+
+// complete is called when a produced record is acknowledged or fails.
+func (d *delivery) complete(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pending--
+	if err != nil && d.err == nil {
+		d.err = err
+	}
+	if d.sealed && d.pending == 0 {
+		close(d.done)
+	}
+}
+
+// seal is called when the consumed record is processed. No record should be produced for it afterwards.
+func (d *delivery) seal() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.sealed {
+		return
+	}
+	d.sealed = true
+	if d.pending == 0 {
+		close(d.done)
+	}
+}
+
+func (d *delivery) Done() <-chan struct{} {
+	return d.done
+}
+
+// Err returns the first error of produced records. It should be called after Done is closed.
+func (d *delivery) Err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
@@ -4,5 +4,14 @@ import "fmt"
 
 var (
 	ErrRedisConfNotInitialized = fmt.Errorf("redis config is not initialized")
-	ErrConsumerNotify          = fmt.Errorf("consumer exits with notify")
 )
+
+// panicError is returned by a process callback that panics. It keeps the stack trace of the panic.
+type panicError struct {
+	recovered any
+	stack     []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("recovered from panic: %v", e.recovered)
+}
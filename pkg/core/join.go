@@ -0,0 +1,149 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/TTraveller7/invokerlib/pkg/conf"
+	"github.com/TTraveller7/invokerlib/pkg/consts"
+	"github.com/TTraveller7/invokerlib/pkg/models"
+)
+
+// windowRecord is a record buffered in a window, with the index of the input it comes from and the timestamp it
+// is assigned to a window with.
+type windowRecord struct {
+	record     *models.Record
+	topicIndex int
+	timestamp  int64
+}
+
+// joinKeyOf returns the join key of a record. It is extracted by the key extractor of the input if there is one,
+// or is the record key otherwise.
+func joinKeyOf(wr *windowRecord) (string, error) {
+	if processorCallbacks.JoinKeyExtractors == nil {
+		return wr.record.Key(), nil
+	}
+	topic := conf.Config().ConsumerConfigs[wr.topicIndex].Topic
+	extractor, exists := processorCallbacks.JoinKeyExtractors[topic]
+	if !exists {
+		return wr.record.Key(), nil
+	}
+	return extractor(wr.record)
+}
+
+// crossJoinKey puts all records under the same join key, so every combination of records is joined.
+func crossJoinKey(wr *windowRecord) (string, error) {
+	return "", nil
+}
+
+// windowJoin groups records of each input in a window by join key, and calls joinCallback on the cartesian
+// product of the groups of each key. If the group of an input is empty, the key is skipped unless the join type
+// preserves the other inputs, in which case nil takes the place of the missing record:
+// - inner: no input is missing
+// - left: keys of the first input are kept, and other inputs may be missing
+// - right: keys of the last input are kept, and other inputs may be missing
+// - full: all keys are kept, and any input may be missing
+func windowJoin(ctx context.Context, w *window, joinType string, keyFunc func(wr *windowRecord) (string, error),
+	joinCallback models.MultiJoinCallback) error {
+
+	// keys are visited in the order they are first seen
+	keys := make([]string, 0)
+	indexes := make([]map[string][]*windowRecord, len(w.inputs))
+	for i, records := range w.inputs {
+		indexes[i] = make(map[string][]*windowRecord, len(records))
+		for _, wr := range records {
+			key, err := keyFunc(wr)
+			if err != nil {
+				metricsClient.EmitCounter("window_join_key_error", "Number of records whose join key cannot be extracted", 1)
+				logs.Printf("extract join key of record %s of input %v failed: %v", wr.record.Key(), i, err)
+				continue
+			}
+			if !keyExists(indexes, key) {
+				keys = append(keys, key)
+			}
+			indexes[i][key] = append(indexes[i][key], wr)
+		}
+	}
+
+	last := len(w.inputs) - 1
+	groups := make([][]*windowRecord, len(w.inputs))
+	missing := []*windowRecord{nil}
+	for _, key := range keys {
+		matched := true
+		for i := range w.inputs {
+			groups[i] = indexes[i][key]
+			if len(groups[i]) > 0 {
+				continue
+			}
+			switch {
+			case joinType == consts.JoinTypeFull,
+				joinType == consts.JoinTypeLeft && i != 0 && len(indexes[0][key]) > 0,
+				joinType == consts.JoinTypeRight && i != last && len(indexes[last][key]) > 0:
+				groups[i] = missing
+			default:
+				matched = false
+			}
+		}
+		if !matched {
+			continue
+		}
+		if err := joinProduct(ctx, groups, w.accept, joinCallback); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func keyExists(indexes []map[string][]*windowRecord, key string) bool {
+	for _, index := range indexes {
+		if _, exists := index[key]; exists {
+			return true
+		}
+	}
+	return false
+}
+
+// joinProduct calls joinCallback on the combinations in the cartesian product of groups that are accepted.
+func joinProduct(ctx context.Context, groups [][]*windowRecord, accept func(records []*windowRecord) bool,
+	joinCallback models.MultiJoinCallback) error {
+
+	combination := make([]*windowRecord, len(groups))
+	var visit func(i int) error
+	visit = func(i int) error {
+		if i == len(groups) {
+			if accept != nil && !accept(combination) {
+				return nil
+			}
+			records := make([]*models.Record, len(combination))
+			for j, wr := range combination {
+				if wr != nil {
+					records[j] = wr.record
+				}
+			}
+			if err := joinCallback(ctx, records); err != nil {
+				return fmt.Errorf("join callback failed: %v", err)
+			}
+			return nil
+		}
+		for _, wr := range groups[i] {
+			combination[i] = wr
+			if err := visit(i + 1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return visit(0)
+}
+
+// multiJoinCallback returns the multi join callback of a join processor. A binary join callback is called with the
+// records of the two inputs.
+func multiJoinCallback(pc *models.ProcessorCallbacks) models.MultiJoinCallback {
+	if pc.MultiJoin != nil {
+		return pc.MultiJoin
+	}
+	join := pc.Join
+	return func(ctx context.Context, records []*models.Record) error {
+		return join(ctx, records[0], records[1])
+	}
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/TTraveller7/invokerlib/pkg/consts"
+	"github.com/TTraveller7/invokerlib/pkg/models"
+)
+
+func TestWindowJoin(t *testing.T) {
+	// records are keyed by join key, and valued by name
+	newInputs := func(inputs ...[]string) [][]*windowRecord {
+		res := make([][]*windowRecord, len(inputs))
+		for i, records := range inputs {
+			for _, r := range records {
+				kv := strings.Split(r, "=")
+				res[i] = append(res[i], &windowRecord{
+					record:     models.NewRecord(kv[0], []byte(kv[1])),
+					topicIndex: i,
+				})
+			}
+		}
+		return res
+	}
+	recordKey := func(wr *windowRecord) (string, error) {
+		return wr.record.Key(), nil
+	}
+	tests := []struct {
+		name     string
+		inputs   [][]*windowRecord
+		joinType string
+		want     []string
+	}{
+		{
+			name:     "inner",
+			inputs:   newInputs([]string{"a=l1", "b=l2", "a=l3"}, []string{"a=r1", "c=r2"}),
+			joinType: consts.JoinTypeInner,
+			want:     []string{"l1,r1", "l3,r1"},
+		},
+		{
+			name:     "left",
+			inputs:   newInputs([]string{"a=l1", "b=l2"}, []string{"a=r1", "c=r2"}),
+			joinType: consts.JoinTypeLeft,
+			want:     []string{"l1,r1", "l2,nil"},
+		},
+		{
+			name:     "right",
+			inputs:   newInputs([]string{"a=l1", "b=l2"}, []string{"a=r1", "c=r2"}),
+			joinType: consts.JoinTypeRight,
+			want:     []string{"l1,r1", "nil,r2"},
+		},
+		{
+			name:     "full",
+			inputs:   newInputs([]string{"a=l1", "b=l2"}, []string{"a=r1", "c=r2"}),
+			joinType: consts.JoinTypeFull,
+			want:     []string{"l1,r1", "l2,nil", "nil,r2"},
+		},
+		{
+			name:     "three inputs",
+			inputs:   newInputs([]string{"a=o1", "b=o2"}, []string{"a=l1", "a=l2", "b=l3"}, []string{"a=p1"}),
+			joinType: consts.JoinTypeInner,
+			want:     []string{"o1,l1,p1", "o1,l2,p1"},
+		},
+		{
+			name:     "three inputs left",
+			inputs:   newInputs([]string{"a=o1", "b=o2"}, []string{"a=l1", "b=l3"}, []string{"a=p1"}),
+			joinType: consts.JoinTypeLeft,
+			want:     []string{"o1,l1,p1", "o2,l3,nil"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make([]string, 0)
+			joinCallback := func(ctx context.Context, records []*models.Record) error {
+				vals := make([]string, 0, len(records))
+				for _, r := range records {
+					if r == nil {
+						vals = append(vals, "nil")
+					} else {
+						vals = append(vals, string(r.Value()))
+					}
+				}
+				got = append(got, strings.Join(vals, ","))
+				return nil
+			}
+			if err := windowJoin(context.Background(), &window{inputs: tt.inputs}, tt.joinType, recordKey, joinCallback); err != nil {
+				t.Fatalf("windowJoin() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("windowJoin() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
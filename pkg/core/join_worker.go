@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/TTraveller7/invokerlib/pkg/models"
@@ -10,40 +11,125 @@ import (
 	"github.com/bytedance/sonic"
 )
 
+// bufferedRecord is a record buffered in a pane. Id is unique among buffered records, so records with the same key
+// are kept apart. Timestamp is the timestamp the record is assigned to a window with.
+type bufferedRecord struct {
+	Id           string          `json:"id"`
+	Key          string          `json:"key"`
+	Value        []byte          `json:"value"`
+	Timestamp    int64           `json:"ts"`
+	MsgTimestamp int64           `json:"msg_ts"`
+	Headers      []models.Header `json:"headers"`
+}
+
+func newBufferedRecord(record *models.Record, ts int64) *bufferedRecord {
+	br := toBufferedRecord(record, ts)
+	br.Id = utils.NewRecordId().String()
+	return br
+}
+
+// toBufferedRecord returns the buffered form of a record without an id.
+func toBufferedRecord(record *models.Record, ts int64) *bufferedRecord {
+	br := &bufferedRecord{
+		Key:       record.Key(),
+		Value:     record.Value(),
+		Timestamp: ts,
+		Headers:   record.Headers(),
+	}
+	if !record.Timestamp().IsZero() {
+		br.MsgTimestamp = record.Timestamp().UnixMilli()
+	}
+	return br
+}
+
+// snapshotRecord is a record kept by a windowJoiner in its snapshot.
+type snapshotRecord struct {
+	Record     *bufferedRecord `json:"record"`
+	TopicIndex int             `json:"topic_index"`
+}
+
+func (br *bufferedRecord) toWindowRecord(topicIndex int) *windowRecord {
+	record := models.NewRecord(br.Key, br.Value)
+	if br.MsgTimestamp != 0 {
+		record.SetTimestamp(time.UnixMilli(br.MsgTimestamp))
+	}
+	for _, h := range br.Headers {
+		record.AddHeader(h.Key, h.Value)
+	}
+	return &windowRecord{
+		record:     record,
+		topicIndex: topicIndex,
+		timestamp:  br.Timestamp,
+	}
+}
+
 type JoinWorker struct {
 	w          *Watermark
-	s          state.StateStore
+	ps         *paneStore
+	topicIndex int
 	expireTime int
 }
 
-func NewJoinWorker(w *Watermark, s state.StateStore, expierTime int) *JoinWorker {
+func NewJoinWorker(w *Watermark, ps *paneStore, topicIndex int, expierTime int) *JoinWorker {
 	return &JoinWorker{
 		w:          w,
-		s:          s,
+		ps:         ps,
+		topicIndex: topicIndex,
 		expireTime: expierTime,
 	}
 }
 
+// JoinWorkerProcessCallback appends a record to the buffer of its pane and partition. Buffers are registered in the
+// pane store, so the records of a pane can be found by any run of the processor.
 func (j *JoinWorker) JoinWorkerProcessCallback(ctx context.Context, record *models.Record) error {
-	processingTimestamp := time.Now().Unix()
-	watermark := j.w.Get()
-	if processingTimestamp < watermark {
+	ts := time.Now().Unix()
+	if j.w.IsEventTime() && !record.Timestamp().IsZero() {
+		ts = record.Timestamp().Unix()
+	}
+	paneStart, ok := j.w.Assign(ts)
+	if !ok {
 		// drop record
+		metricsClient.EmitCounter("join_late_record", "Number of records dropped because their window is closed", 1)
 		return nil
 	}
-	batchId := utils.BatchId(ctx, watermark)
-	keySet, err := j.s.Get(ctx, batchId)
-	keys := make([]string, 0)
-	if err == nil {
-		sonic.Unmarshal(keySet, &keys)
+
+	// in processing time mode, the record may be assigned to a pane that has ended
+	if ts >= paneStart+j.w.Size() {
+		ts = paneStart + j.w.Size() - 1
 	}
-	keys = append(keys, record.Key())
-	if err := j.s.PutWithExpireTime(ctx, record.Key(), record.Value(), j.expireTime); err != nil {
-		return err
+
+	br := newBufferedRecord(record, ts)
+	brBytes, err := sonic.Marshal(br)
+	if err != nil {
+		return fmt.Errorf("marshal buffered record failed: %v", err)
 	}
-	keySet, _ = sonic.Marshal(keys)
-	if err := j.s.Put(ctx, batchId, keySet); err != nil {
+	pb := paneBuffer{
+		Id:         j.ps.bufferId(paneStart, j.topicIndex, record.Partition()),
+		TopicIndex: j.topicIndex,
+	}
+	// the buffer is registered first, so it is not left behind if appending fails
+	if err := j.ps.register(ctx, paneStart, pb); err != nil {
 		return err
 	}
-	return nil
+	return j.ps.s.AppendWithExpireTime(ctx, pb.Id, brBytes, j.expireTime)
+}
+
+// fetchBufferedRecords returns the records in a buffer.
+func fetchBufferedRecords(ctx context.Context, stateStore state.CollectionStateStore,
+	pb paneBuffer) ([]*windowRecord, error) {
+
+	elements, err := stateStore.ListRange(ctx, pb.Id, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*windowRecord, 0, len(elements))
+	for _, e := range elements {
+		br := &bufferedRecord{}
+		if err := sonic.Unmarshal(e, br); err != nil {
+			logs.Printf("unmarshal buffered record of buffer %s failed: %v", pb.Id, err)
+			continue
+		}
+		res = append(res, br.toWindowRecord(pb.TopicIndex))
+	}
+	return res, nil
 }
@@ -0,0 +1,235 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/TTraveller7/invokerlib/pkg/consts"
+	"github.com/TTraveller7/invokerlib/pkg/state"
+	"github.com/bytedance/sonic"
+)
+
+// paneStore persists the panes of a join or aggregate processor, so panes left open by a previous run can be
+// closed after a restart:
+// - the open pane set holds the start of every pane that has buffered records and is not closed yet
+// - the buffer set of a pane holds the buffers that records of the pane are stored in
+// - the closed watermark is the end of the last closed pane
+// - the snapshot holds the records or accumulators kept in memory for windows that are not closed yet
+//
+// Buffers are identified by processor, pane, input and partition, so they do not depend on the workers or pods
+// that write them.
+type paneStore struct {
+	s    state.CollectionStateStore
+	name string
+
+	// registered caches the buffers added to buffer sets by this processor, by pane start
+	mu         sync.Mutex
+	registered map[int64]map[string]bool
+}
+
+// paneBuffer is an entry of the buffer set of a pane.
+type paneBuffer struct {
+	Id         string `json:"id"`
+	TopicIndex int    `json:"topic_index"`
+}
+
+func newPaneStore(s state.StateStore, name string) (*paneStore, error) {
+	cs, ok := state.AsCollectionStateStore(s)
+	if !ok {
+		return nil, fmt.Errorf("state store does not support collections")
+	}
+	return &paneStore{
+		s:          cs,
+		name:       name,
+		registered: make(map[int64]map[string]bool, 0),
+	}, nil
+}
+
+func (ps *paneStore) openPanesKey() string {
+	return fmt.Sprintf("%s-open-panes", ps.name)
+}
+
+func (ps *paneStore) paneKey(paneStart int64) string {
+	return fmt.Sprintf("%s-pane-%v", ps.name, paneStart)
+}
+
+func (ps *paneStore) closedKey() string {
+	return fmt.Sprintf("%s-closed-watermark", ps.name)
+}
+
+func (ps *paneStore) snapshotKey() string {
+	return fmt.Sprintf("%s-pane-snapshot", ps.name)
+}
+
+func (ps *paneStore) bufferId(paneStart int64, topicIndex int, partition int32) string {
+	return fmt.Sprintf("%s-pane-%v-%v-%v", ps.name, paneStart, topicIndex, partition)
+}
+
+// register adds a buffer to the buffer set of its pane, and the pane to the open pane set.
+func (ps *paneStore) register(ctx context.Context, paneStart int64, pb paneBuffer) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.registered[paneStart][pb.Id] {
+		return nil
+	}
+
+	pbBytes, _ := sonic.Marshal(pb)
+	if err := ps.s.SetAdd(ctx, ps.paneKey(paneStart), pbBytes); err != nil {
+		return err
+	}
+	if err := ps.s.SetAdd(ctx, ps.openPanesKey(), []byte(strconv.FormatInt(paneStart, 10))); err != nil {
+		return err
+	}
+	if ps.registered[paneStart] == nil {
+		ps.registered[paneStart] = make(map[string]bool, 0)
+	}
+	ps.registered[paneStart][pb.Id] = true
+	return nil
+}
+
+// buffers returns the buffers of a pane.
+func (ps *paneStore) buffers(ctx context.Context, paneStart int64) ([]paneBuffer, error) {
+	members, err := ps.s.SetMembers(ctx, ps.paneKey(paneStart))
+	if err != nil {
+		return nil, err
+	}
+	res := make([]paneBuffer, 0, len(members))
+	for _, member := range members {
+		pb := paneBuffer{}
+		if err := sonic.Unmarshal(member, &pb); err != nil {
+			return nil, fmt.Errorf("unmarshal pane buffer failed: %v", err)
+		}
+		res = append(res, pb)
+	}
+	return res, nil
+}
+
+// close removes a pane from the open pane set, and moves the closed watermark to the pane end. The buffers of the
+// pane must be deleted before.
+func (ps *paneStore) close(ctx context.Context, paneStart int64, paneEnd int64) error {
+	// panes closed by another pod are not closed by this processor, so earlier panes are dropped from the cache too
+	ps.mu.Lock()
+	for registeredPane := range ps.registered {
+		if registeredPane <= paneStart {
+			delete(ps.registered, registeredPane)
+		}
+	}
+	ps.mu.Unlock()
+
+	if err := ps.s.Delete(ctx, ps.paneKey(paneStart)); err != nil {
+		return err
+	}
+	if err := ps.s.SetRemove(ctx, ps.openPanesKey(), []byte(strconv.FormatInt(paneStart, 10))); err != nil {
+		return err
+	}
+	closed, exists, err := ps.closedWatermark(ctx)
+	if err != nil {
+		return err
+	}
+	if exists && closed >= paneEnd {
+		return nil
+	}
+	return ps.s.Put(ctx, ps.closedKey(), []byte(strconv.FormatInt(paneEnd, 10)))
+}
+
+// openPanes returns the starts of open panes in order.
+func (ps *paneStore) openPanes(ctx context.Context) ([]int64, error) {
+	members, err := ps.s.SetMembers(ctx, ps.openPanesKey())
+	if err != nil {
+		return nil, err
+	}
+	res := make([]int64, 0, len(members))
+	for _, member := range members {
+		paneStart, err := strconv.ParseInt(string(member), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse open pane %s failed: %v", string(member), err)
+		}
+		res = append(res, paneStart)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i] < res[j]
+	})
+	return res, nil
+}
+
+// closedWatermark returns the end of the last closed pane, and false if no pane has been closed.
+func (ps *paneStore) closedWatermark(ctx context.Context) (int64, bool, error) {
+	val, err := ps.s.Get(ctx, ps.closedKey())
+	if err == consts.ErrStateStoreKeyNotExist {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+	closed, err := strconv.ParseInt(string(val), 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("parse closed watermark %s failed: %v", string(val), err)
+	}
+	return closed, true, nil
+}
+
+// paneSnapshot is what a joiner or an aggregator keeps in memory after the pane starting at PaneStart is closed,
+// which are the records or accumulators of windows that are not closed yet.
+type paneSnapshot[T any] struct {
+	PaneStart int64 `json:"pane_start"`
+	Pending   []T   `json:"pending"`
+}
+
+// saveSnapshot saves what is kept in memory after the pane starting at paneStart is closed. It must be saved
+// before the buffers of the pane are deleted, so records of windows that are not closed yet survive a restart.
+func saveSnapshot[T any](ctx context.Context, ps *paneStore, paneStart int64, pending []T) error {
+	snapshotBytes, err := sonic.Marshal(paneSnapshot[T]{
+		PaneStart: paneStart,
+		Pending:   pending,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal pane snapshot failed: %v", err)
+	}
+	return ps.s.Put(ctx, ps.snapshotKey(), snapshotBytes)
+}
+
+// loadSnapshot returns the snapshot saved by a previous run, and false if there is none.
+func loadSnapshot[T any](ctx context.Context, ps *paneStore) (paneSnapshot[T], bool, error) {
+	var snapshot paneSnapshot[T]
+	snapshotBytes, err := ps.s.Get(ctx, ps.snapshotKey())
+	if err == consts.ErrStateStoreKeyNotExist {
+		return snapshot, false, nil
+	} else if err != nil {
+		return snapshot, false, err
+	}
+	if err := sonic.Unmarshal(snapshotBytes, &snapshot); err != nil {
+		return snapshot, false, fmt.Errorf("unmarshal pane snapshot failed: %v", err)
+	}
+	return snapshot, true, nil
+}
+
+// recover returns the open panes that should have been closed, given the watermark w of this run. In event time
+// mode, w starts from the closed watermark, or from the first open pane if no pane has been closed, so records of
+// panes closed by the previous run are dropped as late, and the remaining open panes are closed as usual.
+func (ps *paneStore) recover(ctx context.Context, w *Watermark) ([]int64, error) {
+	closed, exists, err := ps.closedWatermark(ctx)
+	if err != nil {
+		return nil, err
+	}
+	panes, err := ps.openPanes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if w.IsEventTime() {
+		if exists {
+			w.Restore(closed)
+		} else if len(panes) > 0 {
+			w.Restore(panes[0])
+		}
+	}
+
+	res := make([]int64, 0, len(panes))
+	for _, paneStart := range panes {
+		if paneStart < w.Get() {
+			res = append(res, paneStart)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,129 @@
+package core
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/IBM/sarama"
+	"github.com/TTraveller7/invokerlib/pkg/conf"
+	"github.com/TTraveller7/invokerlib/pkg/consts"
+	"github.com/TTraveller7/invokerlib/pkg/models"
+	"github.com/TTraveller7/invokerlib/pkg/utils"
+)
+
+// messageMetadata is attached to produced messages as sarama.ProducerMessage.Metadata.
+type messageMetadata struct {
+	// record is the record that the message is created from. It is nil for dead letter messages.
+	record *models.Record
+
+	// partition is the partition specified by user, or -1 if not specified
+	partition int32
+
+	// d is the delivery that the result of the message is reported to in async mode
+	d *delivery
+}
+
+func metadataOf(msg *sarama.ProducerMessage) *messageMetadata {
+	meta, ok := msg.Metadata.(*messageMetadata)
+	if !ok {
+		meta = &messageMetadata{
+			partition: -1,
+		}
+		msg.Metadata = meta
+	}
+	return meta
+}
+
+// newPartitioner creates the partitioner of a topic from its partitioner config. It is used as the partitioner
+// constructor of all producers, since one sarama producer is shared by topics on the same address.
+func newPartitioner(topic string) sarama.Partitioner {
+	pc := conf.Config().Partitioners[topic]
+	if pc == nil {
+		pc = &conf.PartitionerConfig{}
+	}
+
+	p := &outputPartitioner{
+		topic: topic,
+	}
+	switch pc.Type {
+	case consts.PartitionerTypeRoundRobin:
+		p.base = sarama.NewRoundRobinPartitioner(topic)
+	case consts.PartitionerTypeSticky:
+		p.base = &stickyPartitioner{}
+	case consts.PartitionerTypeCallback:
+		p.callback = processorCallbacks.Partitioner
+		p.base = sarama.NewHashPartitioner(topic)
+	default:
+		switch pc.Hash {
+		case consts.HashMurmur2:
+			// same as the default partitioner of the Java Kafka client
+			p.base = sarama.NewCustomPartitioner(sarama.WithAbsFirst(),
+				sarama.WithCustomHashFunction(utils.NewMurmur2))(topic)
+		case consts.HashCRC32:
+			p.base = sarama.NewConsistentCRCHashPartitioner(topic)
+		default:
+			p.base = sarama.NewHashPartitioner(topic)
+		}
+	}
+	return p
+}
+
+// outputPartitioner sends a message to the partition specified by user if there is one. Otherwise it uses the
+// callback, or the base partitioner if there is no callback or the message is not created from a record.
+type outputPartitioner struct {
+	topic    string
+	base     sarama.Partitioner
+	callback models.PartitionerCallback
+}
+
+func (p *outputPartitioner) Partition(msg *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	meta, _ := msg.Metadata.(*messageMetadata)
+	if meta != nil && meta.partition >= 0 {
+		if meta.partition >= numPartitions {
+			return -1, fmt.Errorf("partition %v is out of range: topic %s has %v partitions",
+				meta.partition, p.topic, numPartitions)
+		}
+		return meta.partition, nil
+	}
+	if p.callback != nil && meta != nil && meta.record != nil {
+		return p.callback(p.topic, meta.record, numPartitions)
+	}
+	return p.base.Partition(msg, numPartitions)
+}
+
+func (p *outputPartitioner) RequiresConsistency() bool {
+	return true
+}
+
+// MessageRequiresConsistency returns true if the partition is not chosen by the base partitioner, so that the
+// partition is not remapped to writable partitions by sarama.
+func (p *outputPartitioner) MessageRequiresConsistency(msg *sarama.ProducerMessage) bool {
+	meta, _ := msg.Metadata.(*messageMetadata)
+	if meta != nil && (meta.partition >= 0 || (p.callback != nil && meta.record != nil)) {
+		return true
+	}
+	if dcp, ok := p.base.(sarama.DynamicConsistencyPartitioner); ok {
+		return dcp.MessageRequiresConsistency(msg)
+	}
+	return p.base.RequiresConsistency()
+}
+
+// stickyPartitioner sends messages to one partition until StickyPartitionerBatchSize messages are sent, and then
+// switches to a random partition. It is only called by the partition dispatcher goroutine of its topic.
+type stickyPartitioner struct {
+	partition int32
+	count     int
+}
+
+func (p *stickyPartitioner) Partition(msg *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	if p.count == 0 || p.count >= consts.StickyPartitionerBatchSize || p.partition >= numPartitions {
+		p.partition = rand.Int31n(numPartitions)
+		p.count = 0
+	}
+	p.count++
+	return p.partition, nil
+}
+
+func (p *stickyPartitioner) RequiresConsistency() bool {
+	return false
+}
@@ -10,18 +10,16 @@ import (
 	"github.com/TTraveller7/invokerlib/pkg/utils"
 )
 
+// PassToDefaultOutputTopic sends record to the default output topic. The headers and timestamp of record are kept.
 func PassToDefaultOutputTopic(ctx context.Context, record *models.Record) error {
 	producer, err := defaultProducer()
 	if err != nil {
 		return err
 	}
-	producer.produce(&sarama.ProducerMessage{
-		Key:   sarama.ByteEncoder(record.Key()),
-		Value: sarama.ByteEncoder(record.Value()),
-	})
-	return nil
+	return producer.produce(ctx, newProducerMessage(record, -1))
 }
 
+// PassToOutputTopic sends record to the output topic with name. The headers and timestamp of record are kept.
 func PassToOutputTopic(ctx context.Context, name string, record *models.Record) error {
 	c := conf.Config()
 	kafkaDest, exists := c.OutputKafkaConfigs[name]
@@ -32,11 +30,46 @@ func PassToOutputTopic(ctx context.Context, name string, record *models.Record)
 	if err != nil {
 		return err
 	}
-	producer.produce(&sarama.ProducerMessage{
-		Key:   sarama.ByteEncoder(record.Key()),
-		Value: sarama.ByteEncoder(record.Value()),
-	})
-	return nil
+	return producer.produce(ctx, newProducerMessage(record, -1))
+}
+
+// PassToOutputTopicWithPartition sends record to the partition of the output topic with name. The partitioner of
+// the output is not used.
+func PassToOutputTopicWithPartition(ctx context.Context, name string, partition int32, record *models.Record) error {
+	if partition < 0 {
+		return fmt.Errorf("partition must be greater than or equal to 0")
+	}
+	c := conf.Config()
+	kafkaDest, exists := c.OutputKafkaConfigs[name]
+	if !exists {
+		return fmt.Errorf("output topic with name %s does not exist", name)
+	}
+	producer, err := getProducer(kafkaDest.Topic)
+	if err != nil {
+		return err
+	}
+	return producer.produce(ctx, newProducerMessage(record, partition))
+}
+
+// newProducerMessage creates a message from record. If partition is -1, the partition is chosen by the
+// partitioner of the output.
+func newProducerMessage(record *models.Record, partition int32) *sarama.ProducerMessage {
+	msg := &sarama.ProducerMessage{
+		Key:       sarama.ByteEncoder(record.Key()),
+		Value:     sarama.ByteEncoder(record.Value()),
+		Timestamp: record.Timestamp(),
+		Metadata: &messageMetadata{
+			record:    record,
+			partition: partition,
+		},
+	}
+	for _, h := range record.Headers() {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{
+			Key:   []byte(h.Key),
+			Value: h.Value,
+		})
+	}
+	return msg
 }
 
 func MetricsClient() *utils.MetricsClient {
@@ -1,69 +1,219 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/IBM/sarama"
 	"github.com/TTraveller7/invokerlib/pkg/conf"
+	"github.com/TTraveller7/invokerlib/pkg/consts"
 )
 
+// saramaProducer is either a sync producer or an async producer to one Kafka address.
+type saramaProducer struct {
+	syncProducer  sarama.SyncProducer
+	asyncProducer sarama.AsyncProducer
+	handlerDone   chan struct{}
+}
+
 type Producer struct {
-	saramaProducer sarama.SyncProducer
+	saramaProducer *saramaProducer
 	topic          string
 }
 
-func (p *Producer) produce(msg *sarama.ProducerMessage) error {
+// produce sends msg to the topic of the producer. If ctx carries a transaction, msg is sent in the transaction.
+// Otherwise in async mode, if ctx carries a delivery, produce returns once msg is enqueued, and the result is
+// reported to the delivery. In other cases produce returns once msg is acknowledged.
+func (p *Producer) produce(ctx context.Context, msg *sarama.ProducerMessage) error {
 	msg.Topic = p.topic
-	_, _, err := p.saramaProducer.SendMessage(msg)
-	return err
+	if t := transactionFromContext(ctx); t != nil {
+		// committed with the consumer offsets
+		t.send(msg)
+		return nil
+	}
+	if p.saramaProducer.asyncProducer == nil {
+		_, _, err := p.saramaProducer.syncProducer.SendMessage(msg)
+		return err
+	}
+
+	d := deliveryFromContext(ctx)
+	if d == nil {
+		d = newDelivery()
+		d.add()
+		metadataOf(msg).d = d
+		p.saramaProducer.asyncProducer.Input() <- msg
+		d.seal()
+		<-d.Done()
+		return d.Err()
+	}
+	d.add()
+	metadataOf(msg).d = d
+	p.saramaProducer.asyncProducer.Input() <- msg
+	return nil
 }
 
 var (
 	dp        *Producer
+	dlp       *Producer
 	producers sync.Map = sync.Map{}
+
+	saramaProducers []*saramaProducer
 )
 
+func saramaProducerConfig(pc *conf.ProducerConfig) *sarama.Config {
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	config.Producer.Partitioner = newPartitioner
+	if pc == nil {
+		return config
+	}
+
+	if pc.Mode == consts.ProducerModeAsync {
+		config.Producer.Return.Errors = true
+		config.Producer.Flush.Frequency = time.Duration(pc.LingerMs) * time.Millisecond
+		config.Producer.Flush.Messages = pc.BatchSize
+	}
+	switch pc.Compression {
+	case "gzip":
+		config.Producer.Compression = sarama.CompressionGZIP
+	case "snappy":
+		config.Producer.Compression = sarama.CompressionSnappy
+	case "lz4":
+		config.Producer.Compression = sarama.CompressionLZ4
+	case "zstd":
+		config.Producer.Compression = sarama.CompressionZSTD
+	}
+	switch pc.Acks {
+	case "none":
+		config.Producer.RequiredAcks = sarama.NoResponse
+	case "all":
+		config.Producer.RequiredAcks = sarama.WaitForAll
+	}
+	return config
+}
+
+func newSaramaProducer(address string, pc *conf.ProducerConfig) (*saramaProducer, error) {
+	config := saramaProducerConfig(pc)
+	if pc == nil || pc.Mode != consts.ProducerModeAsync {
+		syncProducer, err := sarama.NewSyncProducer([]string{address}, config)
+		if err != nil {
+			return nil, err
+		}
+		return &saramaProducer{
+			syncProducer: syncProducer,
+		}, nil
+	}
+
+	asyncProducer, err := sarama.NewAsyncProducer([]string{address}, config)
+	if err != nil {
+		return nil, err
+	}
+	sp := &saramaProducer{
+		asyncProducer: asyncProducer,
+		handlerDone:   make(chan struct{}),
+	}
+	go sp.handleAsyncResults()
+	return sp, nil
+}
+
+// handleAsyncResults reports results of async messages to their deliveries until the async producer is closed.
+func (sp *saramaProducer) handleAsyncResults() {
+	defer close(sp.handlerDone)
+	successes := sp.asyncProducer.Successes()
+	errors := sp.asyncProducer.Errors()
+	for successes != nil || errors != nil {
+		select {
+		case msg, ok := <-successes:
+			if !ok {
+				successes = nil
+				continue
+			}
+			if meta, ok := msg.Metadata.(*messageMetadata); ok && meta.d != nil {
+				meta.d.complete(nil)
+			}
+		case produceErr, ok := <-errors:
+			if !ok {
+				errors = nil
+				continue
+			}
+			metricsClient.EmitCounter("produce_error", "Number of records that are not successfully produced", 1)
+			if meta, ok := produceErr.Msg.Metadata.(*messageMetadata); ok && meta.d != nil {
+				meta.d.complete(produceErr.Err)
+			}
+		}
+	}
+}
+
+func (sp *saramaProducer) close() error {
+	if sp.asyncProducer == nil {
+		return sp.syncProducer.Close()
+	}
+
+	// flushes buffered messages, and waits for their results to be reported
+	sp.asyncProducer.AsyncClose()
+	<-sp.handlerDone
+	return nil
+}
+
 func initProducers() error {
 	producers = sync.Map{}
+	saramaProducers = make([]*saramaProducer, 0)
 
-	// one sarama producer per address
-	addrToSaramaProducer := make(map[string]sarama.SyncProducer, 0)
+	c := conf.Config()
 
-	producerConfig := sarama.NewConfig()
-	producerConfig.Producer.Return.Successes = true
+	// one sarama producer per address
+	addrToSaramaProducer := make(map[string]*saramaProducer, 0)
+	getSaramaProducer := func(address string) (*saramaProducer, error) {
+		if sp, exists := addrToSaramaProducer[address]; exists {
+			return sp, nil
+		}
+		sp, err := newSaramaProducer(address, c.ProducerConfig)
+		if err != nil {
+			return nil, err
+		}
+		addrToSaramaProducer[address] = sp
+		saramaProducers = append(saramaProducers, sp)
+		return sp, nil
+	}
 
-	c := conf.Config()
 	if c.DefaultOutputKafkaConfig != nil {
-		saramaProducer, err := sarama.NewSyncProducer([]string{c.DefaultOutputKafkaConfig.Address}, producerConfig)
+		sp, err := getSaramaProducer(c.DefaultOutputKafkaConfig.Address)
 		if err != nil {
 			return fmt.Errorf("initialize default producer failed: %v", err)
 		}
 		dp = &Producer{
-			saramaProducer: saramaProducer,
+			saramaProducer: sp,
 			topic:          c.DefaultOutputKafkaConfig.Topic,
 		}
-		addrToSaramaProducer[c.DefaultOutputKafkaConfig.Address] = saramaProducer
 	}
 
 	// create other producers
 	for _, producerConf := range c.OutputKafkaConfigs {
-		if _, exists := addrToSaramaProducer[producerConf.Address]; !exists {
-			// create sarama producer
-			saramaProducer, err := sarama.NewSyncProducer([]string{producerConf.Address}, producerConfig)
-			if err != nil {
-				return fmt.Errorf("initialize producer from output kafka config failed: %v", err)
-			}
-			addrToSaramaProducer[producerConf.Address] = saramaProducer
+		sp, err := getSaramaProducer(producerConf.Address)
+		if err != nil {
+			return fmt.Errorf("initialize producer from output kafka config failed: %v", err)
 		}
-
 		producer := &Producer{
-			saramaProducer: addrToSaramaProducer[producerConf.Address],
+			saramaProducer: sp,
 			topic:          producerConf.Topic,
 		}
 		producers.Store(producerConf.Topic, producer)
 	}
 
+	// create dead letter producer
+	if dlc := c.DeadLetterKafkaConfig; dlc != nil {
+		sp, err := getSaramaProducer(dlc.Address)
+		if err != nil {
+			return fmt.Errorf("initialize dead letter producer failed: %v", err)
+		}
+		dlp = &Producer{
+			saramaProducer: sp,
+			topic:          dlc.Topic,
+		}
+	}
+
 	return nil
 }
 
@@ -83,9 +233,9 @@ func getProducer(topic string) (*Producer, error) {
 }
 
 func closeProducers() {
-	producers.Range(func(topic any, producer any) bool {
-		p := producer.(*Producer)
-		p.saramaProducer.Close()
-		return true
-	})
+	for _, sp := range saramaProducers {
+		if err := sp.close(); err != nil {
+			logs.Printf("close producer failed: %v", err)
+		}
+	}
 }
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"context"
+	"log"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/TTraveller7/invokerlib/pkg/conf"
+	"github.com/TTraveller7/invokerlib/pkg/models"
+)
+
+// withRetry wraps attemptFunc so that a failed record is retried according to the retry policy. The error of the
+// last attempt is returned if all attempts fail.
+func withRetry(logs *log.Logger, policy *conf.RetryPolicyConfig,
+	attemptFunc func(ctx context.Context, record *models.Record) error) func(ctx context.Context, record *models.Record) error {
+
+	if policy == nil || policy.MaxAttempts <= 1 {
+		return func(ctx context.Context, record *models.Record) error {
+			return doAttempt(ctx, policy, attemptFunc, record)
+		}
+	}
+
+	return func(ctx context.Context, record *models.Record) error {
+		var err error
+		for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+			if attempt > 1 {
+				metricsClient.EmitCounter("consume_retry", "Number of retries of records that fail processing", 1)
+				select {
+				case <-time.After(retryBackoff(policy, attempt-1)):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			if err = doAttempt(ctx, policy, attemptFunc, record); err == nil {
+				return nil
+			}
+			logs.Printf("attempt #%v of record %s failed: %v", attempt, record.Key(), err)
+		}
+		metricsClient.EmitCounter("consume_retry_exhausted", "Number of records that fail after all retries", 1)
+		return err
+	}
+}
+
+func doAttempt(ctx context.Context, policy *conf.RetryPolicyConfig,
+	attemptFunc func(ctx context.Context, record *models.Record) error, record *models.Record) error {
+
+	if policy == nil || policy.AttemptTimeoutMs <= 0 {
+		return attemptFunc(ctx, record)
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, time.Duration(policy.AttemptTimeoutMs)*time.Millisecond)
+	defer cancel()
+	return attemptFunc(attemptCtx, record)
+}
+
+// retryBackoff returns the backoff before the nth retry, starting from 1.
+func retryBackoff(policy *conf.RetryPolicyConfig, retry int) time.Duration {
+	multiplier := policy.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+	backoff := float64(policy.InitialBackoffMs) * math.Pow(multiplier, float64(retry-1))
+	if policy.MaxBackoffMs > 0 && backoff > float64(policy.MaxBackoffMs) {
+		backoff = float64(policy.MaxBackoffMs)
+	}
+	backoff -= backoff * policy.Jitter * rand.Float64()
+	return time.Duration(backoff * float64(time.Millisecond))
+}
@@ -0,0 +1,134 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/TTraveller7/invokerlib/pkg/conf"
+	"github.com/TTraveller7/invokerlib/pkg/models"
+	"github.com/TTraveller7/invokerlib/pkg/utils"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  *conf.RetryPolicyConfig
+		retry   int
+		wantMin time.Duration
+		wantMax time.Duration
+	}{
+		{
+			name:    "first retry",
+			policy:  &conf.RetryPolicyConfig{InitialBackoffMs: 100},
+			retry:   1,
+			wantMin: 100 * time.Millisecond,
+			wantMax: 100 * time.Millisecond,
+		},
+		{
+			name:    "default multiplier",
+			policy:  &conf.RetryPolicyConfig{InitialBackoffMs: 100},
+			retry:   3,
+			wantMin: 400 * time.Millisecond,
+			wantMax: 400 * time.Millisecond,
+		},
+		{
+			name:    "multiplier",
+			policy:  &conf.RetryPolicyConfig{InitialBackoffMs: 100, Multiplier: 3},
+			retry:   3,
+			wantMin: 900 * time.Millisecond,
+			wantMax: 900 * time.Millisecond,
+		},
+		{
+			name:    "capped",
+			policy:  &conf.RetryPolicyConfig{InitialBackoffMs: 100, MaxBackoffMs: 250},
+			retry:   5,
+			wantMin: 250 * time.Millisecond,
+			wantMax: 250 * time.Millisecond,
+		},
+		{
+			name:    "jitter",
+			policy:  &conf.RetryPolicyConfig{InitialBackoffMs: 1000, Jitter: 0.5},
+			retry:   1,
+			wantMin: 500 * time.Millisecond,
+			wantMax: 1000 * time.Millisecond,
+		},
+		{
+			name:    "capped jitter",
+			policy:  &conf.RetryPolicyConfig{InitialBackoffMs: 1000, MaxBackoffMs: 2000, Jitter: 0.25},
+			retry:   4,
+			wantMin: 1500 * time.Millisecond,
+			wantMax: 2000 * time.Millisecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				got := retryBackoff(tt.policy, tt.retry)
+				if got < tt.wantMin || got > tt.wantMax {
+					t.Fatalf("retryBackoff() = %v, want between %v and %v", got, tt.wantMin, tt.wantMax)
+				}
+			}
+		})
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	metricsClient = utils.NewMetricsClient("retry_test")
+	logs := log.New(os.Stdout, "", log.LstdFlags)
+	tests := []struct {
+		name         string
+		policy       *conf.RetryPolicyConfig
+		failures     int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "no policy", policy: nil, failures: 1, wantAttempts: 1, wantErr: true},
+		{name: "single attempt", policy: &conf.RetryPolicyConfig{MaxAttempts: 1}, failures: 1, wantAttempts: 1,
+			wantErr: true},
+		{name: "succeeds on retry", policy: &conf.RetryPolicyConfig{MaxAttempts: 3}, failures: 2, wantAttempts: 3},
+		{name: "exhausted", policy: &conf.RetryPolicyConfig{MaxAttempts: 3}, failures: 5, wantAttempts: 3,
+			wantErr: true},
+		{name: "no failure", policy: &conf.RetryPolicyConfig{MaxAttempts: 3}, failures: 0, wantAttempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			retryFunc := withRetry(logs, tt.policy, func(ctx context.Context, record *models.Record) error {
+				attempts++
+				if attempts <= tt.failures {
+					return fmt.Errorf("attempt %v failed", attempts)
+				}
+				return nil
+			})
+			err := retryFunc(context.Background(), models.NewRecord("k", nil))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("retryFunc() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("retryFunc() made %v attempts, want %v", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestWithRetry_Canceled(t *testing.T) {
+	metricsClient = utils.NewMetricsClient("retry_canceled_test")
+	logs := log.New(os.Stdout, "", log.LstdFlags)
+	policy := &conf.RetryPolicyConfig{MaxAttempts: 3, InitialBackoffMs: 60000}
+	ctx, cancel := context.WithCancel(context.Background())
+	retryFunc := withRetry(logs, policy, func(ctx context.Context, record *models.Record) error {
+		cancel()
+		return fmt.Errorf("failed")
+	})
+	start := time.Now()
+	if err := retryFunc(ctx, models.NewRecord("k", nil)); err != context.Canceled {
+		t.Errorf("retryFunc() error = %v, want %v", err, context.Canceled)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("retryFunc() waits for the backoff after ctx is canceled")
+	}
+}
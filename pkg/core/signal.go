@@ -0,0 +1,33 @@
+package core
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var signalOnce sync.Once
+
+// handleSignals calls Exit when the process receives SIGTERM, so that in-flight records are drained before
+// the pod is terminated. The signal is raised again after Exit returns to keep the default termination behavior.
+func handleSignals() {
+	signalOnce.Do(func() {
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGTERM)
+		go func() {
+			sig := <-sigCh
+			logs.Printf("received signal %v, exiting", sig)
+			if state, _ := getState(); state != functionStates.Exited {
+				if err := Exit(); err != nil {
+					logs.Printf("exit on signal failed: %v", err)
+				}
+			}
+
+			signal.Stop(sigCh)
+			if p, err := os.FindProcess(os.Getpid()); err == nil {
+				p.Signal(sig)
+			}
+		}()
+	})
+}
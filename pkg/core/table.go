@@ -0,0 +1,303 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/TTraveller7/invokerlib/pkg/conf"
+	"github.com/TTraveller7/invokerlib/pkg/consts"
+	"github.com/TTraveller7/invokerlib/pkg/models"
+	"github.com/TTraveller7/invokerlib/pkg/state"
+	"github.com/TTraveller7/invokerlib/pkg/utils"
+)
+
+var processorTables []*table
+
+// table materialises a compacted topic into a state store by record key. All partitions are read from the oldest
+// offset on start, and the table keeps following the topic until it is closed.
+type table struct {
+	cc        *conf.ConsumerConfig
+	s         state.StateStore
+	keyPrefix string
+
+	client    sarama.Client
+	consumer  sarama.Consumer
+	pcs       []sarama.PartitionConsumer
+	consuming sync.WaitGroup
+
+	// seen holds the record keys applied until stale keys are pruned, and is nil after that
+	seenMu sync.Mutex
+	seen   map[string]bool
+}
+
+func newTable(processorName string, cc *conf.ConsumerConfig, s state.StateStore) *table {
+	return &table{
+		cc:        cc,
+		s:         s,
+		keyPrefix: fmt.Sprintf("%s-table-%s-", processorName, cc.Topic),
+		pcs:       make([]sarama.PartitionConsumer, 0),
+		seen:      make(map[string]bool, 0),
+	}
+}
+
+func (t *table) key(recordKey string) string {
+	return t.keyPrefix + recordKey
+}
+
+// start consumes all partitions of the table topic, and returns when the records in the topic at the time of the
+// call are loaded and stale keys are pruned.
+func (t *table) start(ctx context.Context) error {
+	client, err := sarama.NewClient([]string{t.cc.Address}, defaultSaramaConsumerConfig())
+	if err != nil {
+		return fmt.Errorf("create kafka client failed: %v", err)
+	}
+	t.client = client
+	partitions, err := client.Partitions(t.cc.Topic)
+	if err != nil {
+		return fmt.Errorf("get partitions of topic %s failed: %v", t.cc.Topic, err)
+	}
+	t.consumer, err = sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return fmt.Errorf("create consumer failed: %v", err)
+	}
+
+	loaded := make([]chan struct{}, 0, len(partitions))
+	for _, partition := range partitions {
+		oldest, err := client.GetOffset(t.cc.Topic, partition, sarama.OffsetOldest)
+		if err != nil {
+			return fmt.Errorf("get oldest offset of partition %v failed: %v", partition, err)
+		}
+		newest, err := client.GetOffset(t.cc.Topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return fmt.Errorf("get newest offset of partition %v failed: %v", partition, err)
+		}
+		pc, err := t.consumer.ConsumePartition(t.cc.Topic, partition, sarama.OffsetOldest)
+		if err != nil {
+			return fmt.Errorf("consume partition %v failed: %v", partition, err)
+		}
+		t.pcs = append(t.pcs, pc)
+
+		partitionLoaded := make(chan struct{})
+		loaded = append(loaded, partitionLoaded)
+		if oldest >= newest {
+			close(partitionLoaded)
+		}
+		t.consuming.Add(1)
+		go t.consume(ctx, pc, newest, oldest >= newest, partitionLoaded)
+	}
+
+	for _, partitionLoaded := range loaded {
+		select {
+		case <-partitionLoaded:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	logs.Printf("table %s is loaded", t.cc.Topic)
+	t.prune(ctx)
+	return nil
+}
+
+// prune deletes keys of the table that are not applied while loading. They are left in a persistent state store by
+// a previous run, when their tombstones are compacted away before they are read. Keys are pruned after the table
+// is loaded instead of being cleared before, since a state store shared by pods of the processor holds the table
+// that the other pods are joining against.
+func (t *table) prune(ctx context.Context) {
+	t.seenMu.Lock()
+	defer t.seenMu.Unlock()
+	defer func() {
+		t.seen = nil
+	}()
+	keys, err := state.ScanKeys(ctx, t.s, t.keyPrefix, 0)
+	if err == state.ErrNotImplemented {
+		logs.Printf("stale keys of table %s are not pruned, since the state store cannot be scanned", t.cc.Topic)
+		return
+	} else if err != nil {
+		logs.Printf("scan keys of table %s failed: %v", t.cc.Topic, err)
+		return
+	}
+	stale := make([]string, 0)
+	for _, key := range keys {
+		if !t.seen[strings.TrimPrefix(key, t.keyPrefix)] {
+			stale = append(stale, key)
+		}
+	}
+	if err := state.MultiDelete(ctx, t.s, stale); err != nil {
+		logs.Printf("prune stale keys of table %s failed: %v", t.cc.Topic, err)
+		return
+	}
+	logs.Printf("%v stale keys of table %s are pruned", len(stale), t.cc.Topic)
+}
+
+// consume applies records of a partition to the table until the partition consumer is closed. partitionLoaded is
+// closed when the partition catches up with newest.
+func (t *table) consume(ctx context.Context, pc sarama.PartitionConsumer, newest int64, isLoaded bool,
+	partitionLoaded chan struct{}) {
+
+	defer t.consuming.Done()
+	catchUp := utils.NewCatchUp(newest, consts.CatchUpIdleMs*time.Millisecond,
+		consts.CatchUpFirstRecordTimeoutMs*time.Millisecond)
+	ticker := time.NewTicker(consts.CatchUpCheckIntervalMs * time.Millisecond)
+	defer ticker.Stop()
+	markLoaded := func() {
+		if !isLoaded {
+			isLoaded = true
+			close(partitionLoaded)
+		}
+		// the partition is followed without checking for catching up
+		ticker.Stop()
+	}
+	if isLoaded {
+		markLoaded()
+	}
+	for {
+		select {
+		case msg, ok := <-pc.Messages():
+			if !ok {
+				return
+			}
+			if err := t.apply(ctx, msg); err != nil {
+				metricsClient.EmitCounter("table_apply_error", "Number of table records failed to be applied", 1)
+				logs.Printf("apply record at offset %v of table %s failed: %v", msg.Offset, t.cc.Topic, err)
+			}
+			if catchUp.Consumed(msg.Offset) {
+				markLoaded()
+			}
+		case err, ok := <-pc.Errors():
+			if !ok {
+				return
+			}
+			logs.Printf("consume table %s failed: %v", t.cc.Topic, err)
+		case <-ticker.C:
+			if catchUp.Idle() {
+				markLoaded()
+			}
+		}
+	}
+}
+
+// apply puts a record into the table, or deletes its key if the record is a tombstone.
+func (t *table) apply(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	t.seenMu.Lock()
+	if t.seen != nil {
+		t.seen[string(msg.Key)] = true
+	}
+	t.seenMu.Unlock()
+	if msg.Value == nil {
+		return t.s.Delete(ctx, t.key(string(msg.Key)))
+	}
+	return t.s.Put(ctx, t.key(string(msg.Key)), msg.Value)
+}
+
+// get returns the record of key in the table, or nil if the key does not exist.
+func (t *table) get(ctx context.Context, key string) (*models.Record, error) {
+	val, err := t.s.Get(ctx, t.key(key))
+	if err == consts.ErrStateStoreKeyNotExist {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return models.NewRecord(key, val), nil
+}
+
+func (t *table) close() {
+	for _, pc := range t.pcs {
+		pc.AsyncClose()
+	}
+	t.consuming.Wait()
+	if t.consumer != nil {
+		t.consumer.Close()
+	}
+	if t.client != nil {
+		t.client.Close()
+	}
+}
+
+func closeTables() {
+	for _, t := range processorTables {
+		t.close()
+	}
+	processorTables = nil
+}
+
+// tableJoiner joins each record of the stream input with the records of the tables under its join key. With inner
+// join, a stream record is dropped if any table misses its key.
+type tableJoiner struct {
+	streamIndex  int
+	tables       []*table
+	joinType     string
+	joinCallback models.MultiJoinCallback
+}
+
+func (tj *tableJoiner) process(ctx context.Context, record *models.Record) error {
+	key, err := joinKeyOf(&windowRecord{record: record, topicIndex: tj.streamIndex})
+	if err != nil {
+		return fmt.Errorf("extract join key failed: %v", err)
+	}
+	records := make([]*models.Record, len(tj.tables))
+	records[tj.streamIndex] = record
+	for i, t := range tj.tables {
+		if t == nil {
+			continue
+		}
+		tableRecord, err := t.get(ctx, key)
+		if err != nil {
+			return fmt.Errorf("get key %s from table %s failed: %v", key, t.cc.Topic, err)
+		}
+		if tableRecord == nil && tj.joinType == consts.JoinTypeInner {
+			metricsClient.EmitCounter("table_join_miss", "Number of stream records without a match in tables", 1)
+			return nil
+		}
+		records[i] = tableRecord
+	}
+	return tj.joinCallback(ctx, records)
+}
+
+// startTableJoiner loads the table inputs of the processor into s, and returns the joiner of the stream input.
+func startTableJoiner(ctx context.Context, c *conf.InternalProcessorConfig, s state.StateStore) (*tableJoiner, error) {
+	tj := &tableJoiner{
+		tables:       make([]*table, len(c.ConsumerConfigs)),
+		joinType:     c.JoinType,
+		joinCallback: multiJoinCallback(processorCallbacks),
+	}
+	for i, cc := range c.ConsumerConfigs {
+		if !cc.Table {
+			tj.streamIndex = i
+			continue
+		}
+		t := newTable(c.Name, cc, s)
+		processorTables = append(processorTables, t)
+		if err := t.start(ctx); err != nil {
+			closeTables()
+			return nil, fmt.Errorf("load table %s failed: %v", cc.Topic, err)
+		}
+		tj.tables[i] = t
+	}
+	return tj, nil
+}
+
+// isTableJoin returns true if c is a join processor with table inputs.
+func isTableJoin(c *conf.InternalProcessorConfig) bool {
+	if c.Type != consts.ProcessorTypeJoin {
+		return false
+	}
+	for _, cc := range c.ConsumerConfigs {
+		if cc.Table {
+			return true
+		}
+	}
+	return false
+}
+
+func isTableInput(c *conf.InternalProcessorConfig, topic string) bool {
+	for _, cc := range c.ConsumerConfigs {
+		if cc.Topic == topic && cc.Table {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/TTraveller7/invokerlib/pkg/conf"
+	"github.com/TTraveller7/invokerlib/pkg/consts"
+	"github.com/TTraveller7/invokerlib/pkg/state"
+)
+
+func TestTable_Prune(t *testing.T) {
+	ctx := context.Background()
+	s, _ := state.NewFreeCacheStateStore()
+	tbl := newTable("enrich", &conf.ConsumerConfig{Topic: "products"}, s)
+
+	// keys left by a previous run, and a key of another table
+	s.Put(ctx, tbl.key("stale"), []byte("v"))
+	s.Put(ctx, tbl.key("kept"), []byte("old"))
+	s.Put(ctx, "enrich-table-orders-stale", []byte("v"))
+
+	for _, msg := range []*sarama.ConsumerMessage{
+		{Key: []byte("kept"), Value: []byte("new")},
+		{Key: []byte("added"), Value: []byte("v")},
+	} {
+		if err := tbl.apply(ctx, msg); err != nil {
+			t.Fatalf("apply() error = %v", err)
+		}
+	}
+	tbl.prune(ctx)
+
+	tests := []struct {
+		key        string
+		wantExists bool
+	}{
+		{key: tbl.key("stale"), wantExists: false},
+		{key: tbl.key("kept"), wantExists: true},
+		{key: tbl.key("added"), wantExists: true},
+		{key: "enrich-table-orders-stale", wantExists: true},
+	}
+	for _, tt := range tests {
+		_, err := s.Get(ctx, tt.key)
+		if exists := err != consts.ErrStateStoreKeyNotExist; exists != tt.wantExists {
+			t.Errorf("key %s exists = %v, want %v", tt.key, exists, tt.wantExists)
+		}
+	}
+
+	// keys are not tracked after pruning
+	tbl.apply(ctx, &sarama.ConsumerMessage{Key: []byte("later"), Value: []byte("v")})
+	if tbl.seen != nil {
+		t.Errorf("seen = %v after pruning, want nil", tbl.seen)
+	}
+}
@@ -0,0 +1,122 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/IBM/sarama"
+	"github.com/TTraveller7/invokerlib/pkg/conf"
+	"github.com/TTraveller7/invokerlib/pkg/consts"
+)
+
+// transaction produces records and commits consumer offsets of one partition claim atomically. Records produced
+// while processing a consumed record are buffered until the processing succeeds, so records of failed attempts
+// are not committed.
+type transaction struct {
+	producer sarama.AsyncProducer
+	groupId  string
+	buffered []*sarama.ProducerMessage
+
+	// number of consumed messages in the current transaction
+	successes   int
+	deadLetters int
+}
+
+// newTransaction creates a transactional producer for a partition claim. The transactional id is stable for the
+// partition, so a producer left by a previous owner of the partition is fenced.
+func newTransaction(address string, groupId string, topic string, partition int32) (*transaction, error) {
+	config := saramaProducerConfig(conf.Config().ProducerConfig)
+	config.Version = sarama.V2_0_0_0
+	config.Producer.Return.Successes = false
+	// errors fail the transaction on commit
+	config.Producer.Return.Errors = false
+	config.Producer.Idempotent = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Transaction.ID = fmt.Sprintf("%s-%s-%v", conf.Config().Name, topic, partition)
+	config.Net.MaxOpenRequests = 1
+
+	producer, err := sarama.NewAsyncProducer([]string{address}, config)
+	if err != nil {
+		return nil, err
+	}
+	return &transaction{
+		producer: producer,
+		groupId:  groupId,
+		buffered: make([]*sarama.ProducerMessage, 0),
+	}, nil
+}
+
+func withTransaction(ctx context.Context, t *transaction) context.Context {
+	return context.WithValue(ctx, consts.CTX_KEY_INVOKER_LIB_TRANSACTION, t)
+}
+
+func transactionFromContext(ctx context.Context) *transaction {
+	t, _ := ctx.Value(consts.CTX_KEY_INVOKER_LIB_TRANSACTION).(*transaction)
+	return t
+}
+
+func (t *transaction) begin() error {
+	t.successes = 0
+	t.deadLetters = 0
+	return t.producer.BeginTxn()
+}
+
+// send buffers msg until flush is called.
+func (t *transaction) send(msg *sarama.ProducerMessage) {
+	t.buffered = append(t.buffered, msg)
+}
+
+func (t *transaction) flush() {
+	for _, msg := range t.buffered {
+		t.producer.Input() <- msg
+	}
+	t.buffered = t.buffered[:0]
+}
+
+func (t *transaction) discard() {
+	t.buffered = t.buffered[:0]
+}
+
+// addMessage adds the offset of a consumed message to the transaction.
+func (t *transaction) addMessage(msg *sarama.ConsumerMessage, deadLettered bool) error {
+	if err := t.producer.AddMessageToTxn(msg, t.groupId, nil); err != nil {
+		return err
+	}
+	if deadLettered {
+		t.deadLetters++
+	} else {
+		t.successes++
+	}
+	return nil
+}
+
+func (t *transaction) size() int {
+	return t.successes + t.deadLetters
+}
+
+// commit commits the current transaction. The transaction is aborted if it cannot be committed.
+func (t *transaction) commit() error {
+	if err := t.producer.CommitTxn(); err != nil {
+		if abortErr := t.producer.AbortTxn(); abortErr != nil {
+			logs.Printf("abort transaction failed: %v", abortErr)
+		}
+		return fmt.Errorf("commit transaction failed: %v", err)
+	}
+	metricsClient.EmitCounter("consume_success", "Number of messages that are successfully consumed", float64(t.successes))
+	metricsClient.EmitCounter("consume_dead_letter", "Number of messages that are sent to dead letter topic",
+		float64(t.deadLetters))
+	metricsClient.EmitCounter("transaction_commit", "Number of committed transactions", 1)
+	return nil
+}
+
+// close aborts the current transaction if it is not committed, and closes the producer.
+func (t *transaction) close() {
+	if t.producer.TxnStatus()&sarama.ProducerTxnFlagInTransaction != 0 {
+		if err := t.producer.AbortTxn(); err != nil {
+			logs.Printf("abort transaction failed: %v", err)
+		}
+	}
+	if err := t.producer.Close(); err != nil {
+		logs.Printf("close transactional producer failed: %v", err)
+	}
+}
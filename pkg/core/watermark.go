@@ -5,9 +5,20 @@ import (
 	"time"
 )
 
+// Watermark tracks the start of the earliest pane that has not been closed. Panes are tumbling windows that
+// records are buffered in, and windows of any type are made of panes.
+//
+// In processing time mode, the watermark starts at the current time and records are assigned to the pane
+// starting at the watermark. In event time mode, panes are aligned to the pane size, records are assigned
+// by their timestamps, and the watermark starts at the pane of the first record seen.
 type Watermark struct {
 	t          atomic.Int64
 	windowSize int64
+
+	eventTime         bool
+	maxOutOfOrderness int64
+	allowedLateness   int64
+	maxTimestamp      atomic.Int64
 }
 
 func NewWatermark(windowSize int64) *Watermark {
@@ -18,6 +29,15 @@ func NewWatermark(windowSize int64) *Watermark {
 	return w
 }
 
+func NewEventTimeWatermark(windowSize int64, maxOutOfOrderness int64, allowedLateness int64) *Watermark {
+	return &Watermark{
+		windowSize:        windowSize,
+		eventTime:         true,
+		maxOutOfOrderness: maxOutOfOrderness,
+		allowedLateness:   allowedLateness,
+	}
+}
+
 func (w *Watermark) Get() int64 {
 	return w.t.Load()
 }
@@ -25,3 +45,73 @@ func (w *Watermark) Get() int64 {
 func (w *Watermark) Advance() {
 	w.t.Add(w.windowSize)
 }
+
+// Restore moves the watermark forward to t, which is the watermark of a previous run.
+func (w *Watermark) Restore(t int64) {
+	for {
+		watermark := w.t.Load()
+		if t <= watermark || w.t.CompareAndSwap(watermark, t) {
+			break
+		}
+	}
+}
+
+// Size returns the number of seconds that the watermark advances by.
+func (w *Watermark) Size() int64 {
+	return w.windowSize
+}
+
+func (w *Watermark) IsEventTime() bool {
+	return w.eventTime
+}
+
+// Assign returns the start of the window that a record with timestamp ts belongs to. It returns false if the
+// window has been closed, in which case the record should be dropped.
+func (w *Watermark) Assign(ts int64) (int64, bool) {
+	if !w.eventTime {
+		watermark := w.Get()
+		if ts < watermark {
+			return 0, false
+		}
+		return watermark, true
+	}
+
+	w.observe(ts)
+	windowStart := w.windowStart(ts)
+	if windowStart < w.Get() {
+		return 0, false
+	}
+	return windowStart, true
+}
+
+// ShouldAdvance returns true if the earliest open window can be closed. now is the current processing time,
+// which is ignored in event time mode.
+func (w *Watermark) ShouldAdvance(now int64) bool {
+	watermark := w.Get()
+	if !w.eventTime {
+		return watermark+w.windowSize < now
+	}
+
+	// no record has been seen
+	if watermark == 0 {
+		return false
+	}
+	eventTime := w.maxTimestamp.Load() - w.maxOutOfOrderness
+	return watermark+w.windowSize+w.allowedLateness <= eventTime
+}
+
+func (w *Watermark) observe(ts int64) {
+	for {
+		maxTs := w.maxTimestamp.Load()
+		if ts <= maxTs || w.maxTimestamp.CompareAndSwap(maxTs, ts) {
+			break
+		}
+	}
+
+	// the first window starts from the earliest timestamp allowed by out-of-orderness
+	w.t.CompareAndSwap(0, w.windowStart(ts-w.maxOutOfOrderness))
+}
+
+func (w *Watermark) windowStart(ts int64) int64 {
+	return ts - ts%w.windowSize
+}
@@ -0,0 +1,39 @@
+package core
+
+import "testing"
+
+func TestWatermark_EventTime(t *testing.T) {
+	w := NewEventTimeWatermark(10, 5, 3)
+	if w.ShouldAdvance(0) {
+		t.Fatalf("ShouldAdvance() = true before any record is seen")
+	}
+
+	// the first window starts from the first timestamp minus out-of-orderness
+	if windowStart, ok := w.Assign(1003); !ok || windowStart != 1000 {
+		t.Fatalf("Assign(1003) = %v, %v, want 1000, true", windowStart, ok)
+	}
+	if w.Get() != 990 {
+		t.Fatalf("Get() = %v, want 990", w.Get())
+	}
+
+	// out-of-order record within bound goes to an earlier window
+	if windowStart, ok := w.Assign(998); !ok || windowStart != 990 {
+		t.Fatalf("Assign(998) = %v, %v, want 990, true", windowStart, ok)
+	}
+
+	// window [990, 1000) closes when event time reaches 1000 + allowed lateness
+	w.Assign(1007)
+	if w.ShouldAdvance(0) {
+		t.Fatalf("ShouldAdvance() = true at event time 1002")
+	}
+	w.Assign(1008)
+	if !w.ShouldAdvance(0) {
+		t.Fatalf("ShouldAdvance() = false at event time 1003")
+	}
+	w.Advance()
+
+	// records of closed windows are dropped
+	if _, ok := w.Assign(995); ok {
+		t.Fatalf("Assign(995) = true after window is closed")
+	}
+}
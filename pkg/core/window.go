@@ -0,0 +1,250 @@
+package core
+
+import (
+	"sort"
+
+	"github.com/TTraveller7/invokerlib/pkg/consts"
+)
+
+// windowJoiner assigns records to windows. Records are buffered in panes, which are tumbling windows of paneSize
+// seconds, and windows are made of panes:
+// - tumbling: a pane is a window
+// - hopping: a pane is a slide, and a window is made of size/slide consecutive panes
+// - sliding: a pane is a window size, and records of two consecutive panes are joined if their timestamps are
+// within a window size
+// - session: a pane is a session gap, and records with the same join key form a session until no record arrives
+// within the gap
+// - interval: a pane is the interval length, and a record of the first input is joined with records of other
+// inputs whose timestamps are within [ts-lower, ts+upper] of it
+//
+// A record is stored once in its pane, and is kept in memory by the joiner while it may belong to a window that
+// is not closed yet. The records kept in memory are saved in the pane store each time a pane is closed. closePane
+// is called with panes in order, and is not safe for concurrent use.
+type windowJoiner struct {
+	windowType string
+	size       int64
+	slide      int64
+	gap        int64
+	lower      int64
+	upper      int64
+
+	keyFunc func(wr *windowRecord) (string, error)
+
+	// records of closed panes that belong to windows not closed yet
+	pending []*windowRecord
+
+	// lastPane is the start of the last closed pane, or 0 if no pane is closed
+	lastPane int64
+}
+
+// window is a set of records that are joined together, grouped by input.
+type window struct {
+	inputs [][]*windowRecord
+
+	// accept filters combinations of records, one from each input. Nil accepts all combinations.
+	accept func(records []*windowRecord) bool
+}
+
+func newWindowJoiner(windowType string, size int64, slide int64, gap int64,
+	keyFunc func(wr *windowRecord) (string, error)) *windowJoiner {
+
+	if windowType == "" {
+		windowType = consts.WindowTypeTumbling
+	}
+	return &windowJoiner{
+		windowType: windowType,
+		size:       size,
+		slide:      slide,
+		gap:        gap,
+		keyFunc:    keyFunc,
+		pending:    make([]*windowRecord, 0),
+	}
+}
+
+func newIntervalJoiner(lower int64, upper int64, keyFunc func(wr *windowRecord) (string, error)) *windowJoiner {
+	return &windowJoiner{
+		windowType: consts.WindowTypeInterval,
+		lower:      lower,
+		upper:      upper,
+		keyFunc:    keyFunc,
+		pending:    make([]*windowRecord, 0),
+	}
+}
+
+// paneSize returns the size of panes in seconds.
+func (wj *windowJoiner) paneSize() int64 {
+	switch wj.windowType {
+	case consts.WindowTypeInterval:
+		if wj.lower+wj.upper < consts.JoinMinWindowSize {
+			return consts.JoinMinWindowSize
+		}
+		return wj.lower + wj.upper
+	case consts.WindowTypeHopping:
+		return wj.slide
+	case consts.WindowTypeSession:
+		return wj.gap
+	default:
+		return wj.size
+	}
+}
+
+// closePane adds the records of the pane starting at paneStart, and returns the windows closed with the pane.
+func (wj *windowJoiner) closePane(paneStart int64, records []*windowRecord, numInputs int) []*window {
+	wj.lastPane = paneStart
+	paneEnd := paneStart + wj.paneSize()
+	switch wj.windowType {
+	case consts.WindowTypeHopping:
+		// the window ending at the pane end is closed, and records before the next window are not needed
+		wj.pending = append(wj.pending, records...)
+		windowStart := paneEnd - wj.size
+		w := newWindow(numInputs)
+		for _, wr := range wj.pending {
+			if wr.timestamp >= windowStart {
+				w.add(wr)
+			}
+		}
+		wj.evictBefore(windowStart + wj.slide)
+		return []*window{w}
+	case consts.WindowTypeSliding:
+		// combinations whose earliest record is in the previous pane are closed, since all records within a
+		// window size after it are seen
+		wj.pending = append(wj.pending, records...)
+		anchorStart := paneEnd - 2*wj.size
+		anchorEnd := paneEnd - wj.size
+		w := newWindow(numInputs)
+		for _, wr := range wj.pending {
+			w.add(wr)
+		}
+		w.accept = func(records []*windowRecord) bool {
+			minTs, maxTs := timestampRange(records)
+			return minTs >= anchorStart && minTs < anchorEnd && maxTs-minTs <= wj.size
+		}
+		wj.evictBefore(anchorEnd)
+		return []*window{w}
+	case consts.WindowTypeSession:
+		wj.pending = append(wj.pending, records...)
+		return wj.closeSessions(paneEnd, numInputs)
+	case consts.WindowTypeInterval:
+		// records of the first input whose interval ends in the pane are closed, since all records of other
+		// inputs in their intervals are seen
+		wj.pending = append(wj.pending, records...)
+		anchorStart := paneStart - wj.upper
+		anchorEnd := paneEnd - wj.upper
+		w := newWindow(numInputs)
+		for _, wr := range wj.pending {
+			w.add(wr)
+		}
+		w.accept = func(records []*windowRecord) bool {
+			left := records[0]
+			if left.timestamp < anchorStart || left.timestamp >= anchorEnd {
+				return false
+			}
+			for _, wr := range records[1:] {
+				if wr.timestamp < left.timestamp-wj.lower || wr.timestamp > left.timestamp+wj.upper {
+					return false
+				}
+			}
+			return true
+		}
+		// later records of the first input are joined with records from their ts-lower
+		wj.evictBefore(anchorEnd - wj.lower)
+		return []*window{w}
+	default:
+		w := newWindow(numInputs)
+		for _, wr := range records {
+			w.add(wr)
+		}
+		return []*window{w}
+	}
+}
+
+// closeSessions returns the sessions that cannot be extended by records at or after paneEnd.
+func (wj *windowJoiner) closeSessions(paneEnd int64, numInputs int) []*window {
+	// keys are visited in the order they are first seen
+	keys := make([]string, 0)
+	recordsOfKey := make(map[string][]*windowRecord, 0)
+	for _, wr := range wj.pending {
+		key, err := wj.keyFunc(wr)
+		if err != nil {
+			metricsClient.EmitCounter("window_join_key_error", "Number of records whose join key cannot be extracted", 1)
+			logs.Printf("extract join key of record %s of input %v failed: %v", wr.record.Key(), wr.topicIndex, err)
+			continue
+		}
+		if _, exists := recordsOfKey[key]; !exists {
+			keys = append(keys, key)
+		}
+		recordsOfKey[key] = append(recordsOfKey[key], wr)
+	}
+
+	windows := make([]*window, 0)
+	pending := make([]*windowRecord, 0)
+	for _, key := range keys {
+		records := recordsOfKey[key]
+		sort.SliceStable(records, func(i, j int) bool {
+			return records[i].timestamp < records[j].timestamp
+		})
+		sessionStart := 0
+		for i := range records {
+			if i+1 < len(records) && records[i+1].timestamp-records[i].timestamp <= wj.gap {
+				continue
+			}
+			// records[sessionStart:i+1] is a session
+			session := records[sessionStart : i+1]
+			sessionStart = i + 1
+			if records[i].timestamp+wj.gap >= paneEnd {
+				pending = append(pending, session...)
+				continue
+			}
+			w := newWindow(numInputs)
+			for _, wr := range session {
+				w.add(wr)
+			}
+			windows = append(windows, w)
+		}
+	}
+	wj.pending = pending
+	return windows
+}
+
+func (wj *windowJoiner) evictBefore(ts int64) {
+	pending := make([]*windowRecord, 0, len(wj.pending))
+	for _, wr := range wj.pending {
+		if wr.timestamp >= ts {
+			pending = append(pending, wr)
+		}
+	}
+	wj.pending = pending
+}
+
+func newWindow(numInputs int) *window {
+	return &window{
+		inputs: make([][]*windowRecord, numInputs),
+	}
+}
+
+func (w *window) add(wr *windowRecord) {
+	w.inputs[wr.topicIndex] = append(w.inputs[wr.topicIndex], wr)
+}
+
+// timestampRange returns the minimum and maximum timestamps of records, skipping nil records.
+func timestampRange(records []*windowRecord) (int64, int64) {
+	var minTs, maxTs int64
+	first := true
+	for _, wr := range records {
+		if wr == nil {
+			continue
+		}
+		if first {
+			minTs, maxTs = wr.timestamp, wr.timestamp
+			first = false
+			continue
+		}
+		if wr.timestamp < minTs {
+			minTs = wr.timestamp
+		}
+		if wr.timestamp > maxTs {
+			maxTs = wr.timestamp
+		}
+	}
+	return minTs, maxTs
+}
@@ -0,0 +1,186 @@
+package core
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/TTraveller7/invokerlib/pkg/consts"
+	"github.com/TTraveller7/invokerlib/pkg/models"
+	"github.com/TTraveller7/invokerlib/pkg/state"
+)
+
+func TestWindowJoiner_ClosePane(t *testing.T) {
+	// records are named by key and timestamp
+	newRecord := func(key string, topicIndex int, ts int64) *windowRecord {
+		return &windowRecord{
+			record:     models.NewRecord(key, nil),
+			topicIndex: topicIndex,
+			timestamp:  ts,
+		}
+	}
+	recordKey := func(wr *windowRecord) (string, error) {
+		return wr.record.Key(), nil
+	}
+	type pane struct {
+		start   int64
+		records []*windowRecord
+	}
+	tests := []struct {
+		name   string
+		joiner *windowJoiner
+		panes  []pane
+		// timestamps of records in each window closed by the last pane
+		want [][]int64
+	}{
+		{
+			name:   "tumbling",
+			joiner: newWindowJoiner(consts.WindowTypeTumbling, 10, 0, 0, recordKey),
+			panes: []pane{
+				{start: 0, records: []*windowRecord{newRecord("a", 0, 1), newRecord("a", 1, 9)}},
+				{start: 10, records: []*windowRecord{newRecord("a", 0, 12)}},
+			},
+			want: [][]int64{{12}},
+		},
+		{
+			name:   "hopping",
+			joiner: newWindowJoiner(consts.WindowTypeHopping, 20, 10, 0, recordKey),
+			panes: []pane{
+				{start: 0, records: []*windowRecord{newRecord("a", 0, 1)}},
+				{start: 10, records: []*windowRecord{newRecord("a", 1, 12)}},
+				{start: 20, records: []*windowRecord{newRecord("a", 1, 25)}},
+			},
+			// window [10, 30)
+			want: [][]int64{{12, 25}},
+		},
+		{
+			name:   "sliding",
+			joiner: newWindowJoiner(consts.WindowTypeSliding, 10, 0, 0, recordKey),
+			panes: []pane{
+				{start: 0, records: []*windowRecord{newRecord("a", 0, 1)}},
+				{start: 10, records: []*windowRecord{newRecord("a", 1, 15)}},
+				{start: 20, records: []*windowRecord{newRecord("a", 1, 21)}},
+			},
+			// records of panes [10, 20) and [20, 30)
+			want: [][]int64{{15, 21}},
+		},
+		{
+			name:   "session",
+			joiner: newWindowJoiner(consts.WindowTypeSession, 0, 0, 10, recordKey),
+			panes: []pane{
+				{start: 0, records: []*windowRecord{newRecord("a", 0, 1), newRecord("b", 0, 5)}},
+				{start: 10, records: []*windowRecord{newRecord("a", 1, 10), newRecord("b", 1, 19)}},
+				{start: 20, records: []*windowRecord{newRecord("a", 0, 20)}},
+				{start: 30, records: []*windowRecord{}},
+			},
+			// sessions of b end at 15 and 29, and the session of a from 1 to 20 ends at 30
+			want: [][]int64{{1, 20, 10}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var windows []*window
+			for _, p := range tt.panes {
+				windows = tt.joiner.closePane(p.start, p.records, 2)
+			}
+			got := make([][]int64, 0)
+			for _, w := range windows {
+				timestamps := make([]int64, 0)
+				for _, records := range w.inputs {
+					for _, wr := range records {
+						timestamps = append(timestamps, wr.timestamp)
+					}
+				}
+				got = append(got, timestamps)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("closePane() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWindowJoiner_Interval(t *testing.T) {
+	recordKey := func(wr *windowRecord) (string, error) {
+		return wr.record.Key(), nil
+	}
+	newRecord := func(topicIndex int, ts int64) *windowRecord {
+		return &windowRecord{
+			record:     models.NewRecord("a", []byte(strconv.FormatInt(ts, 10))),
+			topicIndex: topicIndex,
+			timestamp:  ts,
+		}
+	}
+	joiner := newIntervalJoiner(5, 5, recordKey)
+	panes := [][]*windowRecord{
+		{newRecord(0, 8), newRecord(1, 2)},
+		{newRecord(1, 12), newRecord(0, 15), newRecord(1, 19)},
+		{newRecord(1, 21)},
+	}
+	got := make([]string, 0)
+	joinCallback := func(ctx context.Context, records []*models.Record) error {
+		got = append(got, string(records[0].Value())+","+string(records[1].Value()))
+		return nil
+	}
+	for i, records := range panes {
+		for _, w := range joiner.closePane(int64(i)*joiner.paneSize(), records, 2) {
+			if err := windowJoin(context.Background(), w, consts.JoinTypeInner, recordKey, joinCallback); err != nil {
+				t.Fatalf("windowJoin() error = %v", err)
+			}
+		}
+	}
+	// 8 joins [3, 13], and 15 joins [10, 20]
+	want := []string{"8,12", "15,12", "15,19"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("interval join = %v, want %v", got, want)
+	}
+}
+
+func TestWindowJoiner_Restore(t *testing.T) {
+	ctx := context.Background()
+	s, _ := state.NewFreeCacheStateStore()
+	ps, err := newPaneStore(s, "join")
+	if err != nil {
+		t.Fatalf("newPaneStore() error = %v", err)
+	}
+	recordKey := func(wr *windowRecord) (string, error) {
+		return wr.record.Key(), nil
+	}
+	newRecord := func(topicIndex int, ts int64) *windowRecord {
+		return &windowRecord{
+			record:     models.NewRecord("a", []byte(strconv.FormatInt(ts, 10))),
+			topicIndex: topicIndex,
+			timestamp:  ts,
+		}
+	}
+
+	// the window [10, 30) is still open when the processor restarts after closing the pane [10, 20)
+	joiner := newWindowJoiner(consts.WindowTypeHopping, 20, 10, 0, recordKey)
+	joiner.closePane(10, []*windowRecord{newRecord(0, 11)}, 2)
+	if err := saveJoinSnapshot(ctx, joiner, ps); err != nil {
+		t.Fatalf("saveJoinSnapshot() error = %v", err)
+	}
+
+	restarted := newWindowJoiner(consts.WindowTypeHopping, 20, 10, 0, recordKey)
+	if err := restoreJoiner(ctx, restarted, ps); err != nil {
+		t.Fatalf("restoreJoiner() error = %v", err)
+	}
+	if restarted.lastPane != 10 {
+		t.Errorf("lastPane = %v, want 10", restarted.lastPane)
+	}
+	got := make([]string, 0)
+	joinCallback := func(ctx context.Context, records []*models.Record) error {
+		got = append(got, string(records[0].Value())+","+string(records[1].Value()))
+		return nil
+	}
+	for _, w := range restarted.closePane(20, []*windowRecord{newRecord(1, 25)}, 2) {
+		if err := windowJoin(ctx, w, consts.JoinTypeInner, recordKey, joinCallback); err != nil {
+			t.Fatalf("windowJoin() error = %v", err)
+		}
+	}
+	want := []string{"11,25"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("join after restore = %v, want %v", got, want)
+	}
+}
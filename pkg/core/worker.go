@@ -5,35 +5,23 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"runtime/debug"
 	"sync"
 
 	"github.com/IBM/sarama"
 	"github.com/TTraveller7/invokerlib/pkg/conf"
 	"github.com/TTraveller7/invokerlib/pkg/models"
-	"github.com/TTraveller7/invokerlib/pkg/utils"
+	"github.com/TTraveller7/invokerlib/pkg/state"
 )
 
-type WorkerMeta struct {
-	WorkerId   string
-	TopicIndex int
-	Alive      bool
-}
-
+// Work consumes records from the topic in consumerConfig and processes them with processFunc until an "exit"
+// notification is received from workerNotifyChannel. The caller must call wg.Add(1) before starting Work.
 func Work(ctx context.Context, consumerConfig *conf.ConsumerConfig, workerIndex int, processFunc models.ProcessCallback,
 	errCh chan<- error, wg *sync.WaitGroup, workerNotifyChannel <-chan string, workerReadyChannel chan<- struct{}) {
 	// set up worker logger
 	logPrefix := fmt.Sprintf("[worker-%s-%v] ", consumerConfig.Topic, workerIndex)
 	logs := log.New(os.Stdout, logPrefix, log.LstdFlags|log.Lshortfile)
 
-	// add worker meta
-	workerId, _ := utils.WorkerId(ctx)
-	workerMeta := &WorkerMeta{
-		WorkerId:   workerId,
-		TopicIndex: consumerConfig.TopicIndex,
-		Alive:      true,
-	}
-	addWorkerMeta(workerMeta)
-
 	var workerErr error
 	defer func() {
 		if recoverErr := recover(); recoverErr != nil {
@@ -47,7 +35,6 @@ func Work(ctx context.Context, consumerConfig *conf.ConsumerConfig, workerIndex
 		wg.Done()
 		logs.Printf("ends")
 	}()
-	wg.Add(1)
 
 	logs.Printf("starts")
 
@@ -59,36 +46,112 @@ func Work(ctx context.Context, consumerConfig *conf.ConsumerConfig, workerIndex
 		logs.Printf("%v", workerErr)
 		return
 	}
-	consumerGroups = append(consumerGroups, consumerGroup)
+	addConsumerGroup(consumerGroup)
 
-	setupFunc := func() error {
+	// changelog partitions are restored when their input partitions are newly claimed, before they are consumed
+	restored := make(map[int32]bool, 0)
+	setupFunc := func(claims map[string][]int32) error {
+		partitions := make([]int32, 0)
+		for _, partition := range claims[consumerConfig.Topic] {
+			if !restored[partition] {
+				partitions = append(partitions, partition)
+			}
+		}
+		if err := restoreChangelogPartitions(ctx, partitions); err != nil {
+			return err
+		}
+		restored = make(map[int32]bool, len(claims[consumerConfig.Topic]))
+		for _, partition := range claims[consumerConfig.Topic] {
+			restored[partition] = true
+		}
 		return nil
 	}
-	consumeFunc := func(record *models.Record) (consumeFuncErr error) {
+	claimFunc := func(topic string, partition int32) {
+		// partitions claimed after a rebalance are not paused by sarama, so pause them again
+		if pauseClaimIfPaused(consumerGroup, topic, partition) {
+			logs.Printf("processor is paused, pause partition %v of topic %s", partition, topic)
+		}
+	}
+	attemptFunc := func(attemptCtx context.Context, record *models.Record) (consumeFuncErr error) {
 		defer func() {
 			if consumeFuncRecoverErr := recover(); consumeFuncRecoverErr != nil {
-				consumeFuncErr = fmt.Errorf("consumerFunc recovered from panic: %v", consumeFuncRecoverErr)
+				consumeFuncErr = &panicError{
+					recovered: consumeFuncRecoverErr,
+					stack:     debug.Stack(),
+				}
 			}
 			if consumeFuncErr != nil {
 				logs.Printf("consumeFunc failed: %v", consumeFuncErr)
 			}
+
+			// only records of the successful attempt are sent in the transaction
+			if t := transactionFromContext(attemptCtx); t != nil {
+				if consumeFuncErr == nil {
+					t.flush()
+				} else {
+					t.discard()
+				}
+			}
 		}()
-		consumeFuncErr = processFunc(ctx, record)
+		consumeFuncErr = processFunc(attemptCtx, record)
 		return
 	}
-	consumerGroupHandler := NewConsumerGroupHandler(logs, setupFunc, consumeFunc, workerNotifyChannel, workerReadyChannel)
+	retryFunc := withRetry(logs, conf.Config().RetryPolicy, attemptFunc)
+	consumeFunc := func(record *models.Record, d *delivery, t *transaction) error {
+		// state written while processing goes to the changelog partition of the record
+		recordCtx := state.WithPartition(ctx, record.Partition())
+		if t != nil {
+			return retryFunc(withTransaction(recordCtx, t), record)
+		}
+		// records produced while processing are reported to d
+		return retryFunc(withDelivery(recordCtx, d), record)
+	}
+	var deadLetterFunc func(ctx context.Context, msg *sarama.ConsumerMessage, err error) error
+	if dlp != nil {
+		deadLetterFunc = sendToDeadLetter
+	}
+	var newTransactionFunc func(topic string, partition int32) (*transaction, error)
+	if conf.Config().ExactlyOnce {
+		newTransactionFunc = func(topic string, partition int32) (*transaction, error) {
+			// the consumer group id is the topic
+			return newTransaction(consumerConfig.Address, consumerConfig.Topic, topic, partition)
+		}
+	}
+	consumerGroupHandler := NewConsumerGroupHandler(logs, setupFunc, claimFunc, consumeFunc, deadLetterFunc,
+		newTransactionFunc, workerReadyChannel)
+
+	// consumeCtx is cancelled on exit notify. Cancelling it ends the consumer group session after the in-flight
+	// records are processed, and the marked offsets are committed when the session is released.
+	consumeCtx, cancelConsume := context.WithCancel(context.Background())
+	defer cancelConsume()
+	go func() {
+		for {
+			select {
+			case notify := <-workerNotifyChannel:
+				if notify == "exit" {
+					logs.Printf("received exit notify")
+					cancelConsume()
+					return
+				}
+			case <-consumeCtx.Done():
+				return
+			}
+		}
+	}()
 
 	count := 0
 	for {
 		count++
 		logs.Printf("consume loop #%v starts", count)
 
-		if err := consumerGroup.Consume(ctx, []string{consumerConfig.Topic}, consumerGroupHandler); err == ErrConsumerNotify {
-			return
-		} else if err != nil {
+		if err := consumerGroup.Consume(consumeCtx, []string{consumerConfig.Topic}, consumerGroupHandler); err != nil {
 			logs.Printf("consume returns error: %v", err)
 			workerErr = err
 			return
 		}
+		if consumeCtx.Err() != nil {
+			logs.Printf("consume loop exits by notify")
+			return
+		}
 	}
 }
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/TTraveller7/invokerlib/pkg/api"
+	"github.com/TTraveller7/invokerlib/pkg/utils"
+	"github.com/spf13/pflag"
+)
+
+func DeadLetter() {
+	processorPtr := pflag.StringP("processor", "p", "", "processor name")
+	limitPtr := pflag.IntP("limit", "l", 0, "maximum number of dead letter records to show")
+	redrivePtr := pflag.BoolP("redrive", "r", false,
+		"If set to true, dead letter records are sent back to their source topics. Default false.")
+	pflag.Parse()
+	if processorPtr == nil || len(*processorPtr) == 0 {
+		logs.Printf("processor is not provided. Use -p <processor> to provide processor name. ")
+		return
+	}
+
+	p := &api.DeadLetterParams{
+		ProcessorName: *processorPtr,
+		Limit:         *limitPtr,
+	}
+	cmdCli := NewMonitorClient()
+	if *redrivePtr {
+		logs.Printf("sending command redriveDeadLetter to monitor")
+		resp, err := cmdCli.RedriveDeadLetter(p)
+		if err != nil {
+			logs.Printf("redriveDeadLetter failed: %v", err)
+			return
+		} else if resp.Code != api.ResponseCodes.Success {
+			logs.Printf("redriveDeadLetter failed with resp: %+v", resp)
+			return
+		}
+		logs.Printf("redriveDeadLetter finished with resp: %+v", resp)
+		return
+	}
+
+	resp, err := cmdCli.InspectDeadLetter(p)
+	if err != nil {
+		logs.Printf("inspectDeadLetter failed: %v", err)
+		return
+	} else if resp.Code != api.ResponseCodes.Success {
+		logs.Printf("inspectDeadLetter failed with resp: %+v", resp)
+		return
+	}
+	logs.Printf("%+v", utils.SafeJsonIndent(resp))
+}
@@ -38,10 +38,18 @@ func main() {
 		Create()
 	case "run":
 		RunProcessors()
+	case "pause":
+		PauseProcessors()
+	case "resume":
+		ResumeProcessors()
+	case "stop":
+		StopProcessors()
 	case "load":
 		Load()
 	case "cat":
 		Cat()
+	case "dlq":
+		DeadLetter()
 	}
 }
 
@@ -53,7 +61,6 @@ func checkFctlHome() error {
 	return nil
 }
 
-// stop
 // metric
 // log
 // status
@@ -78,6 +78,75 @@ func (m *MonitorClient) RunProcessors() (*api.InvokerResponse, error) {
 	return resp, nil
 }
 
+func (m *MonitorClient) PauseProcessors(p *api.PauseProcessorsParams) (*api.InvokerResponse, error) {
+	params, err := api.MarshalToParams(p)
+	if err != nil {
+		err := fmt.Errorf("monitor client marshal to params failed: %v", err)
+		logs.Printf("%v", err)
+		return nil, err
+	}
+
+	resp, err := m.SendCommand(params, api.MonitorCommands.PauseProcessors)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (m *MonitorClient) ResumeProcessors(p *api.PauseProcessorsParams) (*api.InvokerResponse, error) {
+	params, err := api.MarshalToParams(p)
+	if err != nil {
+		err := fmt.Errorf("monitor client marshal to params failed: %v", err)
+		logs.Printf("%v", err)
+		return nil, err
+	}
+
+	resp, err := m.SendCommand(params, api.MonitorCommands.ResumeProcessors)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (m *MonitorClient) StopProcessors() (*api.InvokerResponse, error) {
+	params := api.NewInvokerRequestParams()
+	resp, err := m.SendCommand(params, api.MonitorCommands.StopProcessors)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (m *MonitorClient) InspectDeadLetter(p *api.DeadLetterParams) (*api.InvokerResponse, error) {
+	params, err := api.MarshalToParams(p)
+	if err != nil {
+		err := fmt.Errorf("monitor client marshal to params failed: %v", err)
+		logs.Printf("%v", err)
+		return nil, err
+	}
+
+	resp, err := m.SendCommand(params, api.MonitorCommands.InspectDeadLetter)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (m *MonitorClient) RedriveDeadLetter(p *api.DeadLetterParams) (*api.InvokerResponse, error) {
+	params, err := api.MarshalToParams(p)
+	if err != nil {
+		err := fmt.Errorf("monitor client marshal to params failed: %v", err)
+		logs.Printf("%v", err)
+		return nil, err
+	}
+
+	resp, err := m.SendCommand(params, api.MonitorCommands.RedriveDeadLetter)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
 func (m *MonitorClient) Load(p *api.LoadParams) (*api.InvokerResponse, error) {
 	params, err := api.MarshalToParams(p)
 	if err != nil {
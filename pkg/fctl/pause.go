@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/TTraveller7/invokerlib/pkg/api"
+	"github.com/spf13/pflag"
+)
+
+func PauseProcessors() {
+	processorsPtr := pflag.StringSliceP("processor", "p", nil,
+		"processor names. If not provided, all processors are paused.")
+	pflag.Parse()
+
+	cli := NewMonitorClient()
+	p := &api.PauseProcessorsParams{
+		ProcessorNames: *processorsPtr,
+	}
+	logs.Printf("sending command pauseProcessors to monitor")
+	resp, err := cli.PauseProcessors(p)
+	if err != nil {
+		logs.Printf("pauseProcessors failed: %v", err)
+		return
+	} else if resp.Code != api.ResponseCodes.Success {
+		logs.Printf("pauseProcessors failed with resp: %+v", resp)
+		return
+	}
+	logs.Printf("pauseProcessors finished with resp: %+v", resp)
+}
+
+func ResumeProcessors() {
+	processorsPtr := pflag.StringSliceP("processor", "p", nil,
+		"processor names. If not provided, all processors are resumed.")
+	pflag.Parse()
+
+	cli := NewMonitorClient()
+	p := &api.PauseProcessorsParams{
+		ProcessorNames: *processorsPtr,
+	}
+	logs.Printf("sending command resumeProcessors to monitor")
+	resp, err := cli.ResumeProcessors(p)
+	if err != nil {
+		logs.Printf("resumeProcessors failed: %v", err)
+		return
+	} else if resp.Code != api.ResponseCodes.Success {
+		logs.Printf("resumeProcessors failed with resp: %+v", resp)
+		return
+	}
+	logs.Printf("resumeProcessors finished with resp: %+v", resp)
+}
@@ -0,0 +1,17 @@
+package main
+
+import "github.com/TTraveller7/invokerlib/pkg/api"
+
+func StopProcessors() {
+	cli := NewMonitorClient()
+	logs.Printf("sending command stopProcessors to monitor")
+	resp, err := cli.StopProcessors()
+	if err != nil {
+		logs.Printf("stopProcessors failed: %v", err)
+		return
+	} else if resp.Code != api.ResponseCodes.Success {
+		logs.Printf("stopProcessors failed with resp: %+v", resp)
+		return
+	}
+	logs.Printf("stopProcessors finished with resp: %+v", resp)
+}
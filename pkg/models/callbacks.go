@@ -4,12 +4,62 @@ import "context"
 
 type InitCallback func() error
 type ProcessCallback func(ctx context.Context, record *Record) error
+
+// JoinCallback is called with a pair of joined records. With an outer join type, either record may be nil.
 type JoinCallback func(ctx context.Context, leftRecord *Record, rightRecord *Record) error
+
+// MultiJoinCallback is called with one record per input of a join processor. Records are in the order of inputs,
+// where input processors come before input Kafka configs. With an outer join type, missing records are nil.
+type MultiJoinCallback func(ctx context.Context, records []*Record) error
 type ExitCallback func()
 
+// KeyExtractorCallback returns the key that a record is joined on.
+type KeyExtractorCallback func(record *Record) (string, error)
+
+// Window is the time range [Start, End) of a window in unix seconds.
+type Window struct {
+	Start int64
+	End   int64
+}
+
+// AggregateCallbacks fold the records of a key in a window into an accumulator, which is emitted when the window
+// closes.
+type AggregateCallbacks struct {
+	// Init returns an empty accumulator.
+	Init func() ([]byte, error)
+
+	// Add returns the accumulator with record added.
+	Add func(ctx context.Context, acc []byte, record *Record) ([]byte, error)
+
+	// Merge returns the accumulator combining a and b. Accumulators of a window are merged in the order of time.
+	Merge func(a []byte, b []byte) ([]byte, error)
+
+	// Emit returns the record sent to the default output topic for the accumulator of key in window. No record
+	// is sent if Emit returns nil.
+	Emit func(ctx context.Context, key string, window Window, acc []byte) (*Record, error)
+}
+
+// PartitionerCallback returns the partition of topic that record is sent to. The partition must be in
+// [0, numPartitions).
+type PartitionerCallback func(topic string, record *Record, numPartitions int32) (int32, error)
+
 type ProcessorCallbacks struct {
 	OnInit  InitCallback
 	Process ProcessCallback
 	Join    JoinCallback
 	OnExit  ExitCallback
+
+	// MultiJoin is used by join processors instead of Join. It must be specified if a join processor has more
+	// than two inputs.
+	MultiJoin MultiJoinCallback
+
+	// JoinKeyExtractors maps input topics of a join processor to their key extractors. Records of an input without
+	// a key extractor are joined on their keys.
+	JoinKeyExtractors map[string]KeyExtractorCallback
+
+	// Partitioner is used by outputs with callback partitioner.
+	Partitioner PartitionerCallback
+
+	// Aggregate is used by aggregate processors.
+	Aggregate *AggregateCallbacks
 }
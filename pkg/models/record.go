@@ -6,24 +6,45 @@ import (
 	"github.com/IBM/sarama"
 )
 
+type Header struct {
+	Key   string
+	Value []byte
+}
+
 type Record struct {
 	msgTimestamp time.Time
 	key          string
 	value        []byte
+	topic        string
+	partition    int32
+	offset       int64
+	headers      []Header
 }
 
 func NewRecord(key string, value []byte) *Record {
 	return &Record{
-		key:   key,
-		value: value,
+		key:    key,
+		value:  value,
+		offset: -1,
 	}
 }
 
 func NewRecordWithConsumerMessage(msg *sarama.ConsumerMessage) *Record {
+	headers := make([]Header, 0, len(msg.Headers))
+	for _, h := range msg.Headers {
+		headers = append(headers, Header{
+			Key:   string(h.Key),
+			Value: h.Value,
+		})
+	}
 	return &Record{
 		msgTimestamp: msg.Timestamp,
 		key:          string(msg.Key),
 		value:        msg.Value,
+		topic:        msg.Topic,
+		partition:    msg.Partition,
+		offset:       msg.Offset,
+		headers:      headers,
 	}
 }
 
@@ -34,3 +55,69 @@ func (r *Record) Key() string {
 func (r *Record) Value() []byte {
 	return r.value
 }
+
+// Topic returns the topic of the Kafka message that the record is consumed from. It returns empty string if the
+// record is not created from a Kafka message.
+func (r *Record) Topic() string {
+	return r.topic
+}
+
+// Partition returns the partition of the Kafka message that the record is consumed from.
+func (r *Record) Partition() int32 {
+	return r.partition
+}
+
+// Offset returns the offset of the Kafka message that the record is consumed from. It returns -1 if the record is
+// not created from a Kafka message.
+func (r *Record) Offset() int64 {
+	return r.offset
+}
+
+// Timestamp returns the timestamp of the Kafka message that the record is consumed from. It returns zero time
+// if the record is not created from a Kafka message.
+func (r *Record) Timestamp() time.Time {
+	return r.msgTimestamp
+}
+
+// SetTimestamp sets the timestamp of the Kafka message that the record is produced to. If the timestamp is zero,
+// the time of producing is used.
+func (r *Record) SetTimestamp(ts time.Time) {
+	r.msgTimestamp = ts
+}
+
+// Headers returns the headers of the record in order. A key may appear more than once.
+func (r *Record) Headers() []Header {
+	return r.headers
+}
+
+// Header returns the value of the last header with key, and whether the header exists.
+func (r *Record) Header(key string) ([]byte, bool) {
+	for i := len(r.headers) - 1; i >= 0; i-- {
+		if r.headers[i].Key == key {
+			return r.headers[i].Value, true
+		}
+	}
+	return nil, false
+}
+
+// SetHeader replaces all headers with key by one header.
+func (r *Record) SetHeader(key string, value []byte) {
+	headers := make([]Header, 0, len(r.headers)+1)
+	for _, h := range r.headers {
+		if h.Key != key {
+			headers = append(headers, h)
+		}
+	}
+	r.headers = append(headers, Header{
+		Key:   key,
+		Value: value,
+	})
+}
+
+// AddHeader appends a header to the record.
+func (r *Record) AddHeader(key string, value []byte) {
+	r.headers = append(r.headers, Header{
+		Key:   key,
+		Value: value,
+	})
+}
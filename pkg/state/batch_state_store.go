@@ -0,0 +1,88 @@
+package state
+
+import (
+	"context"
+
+	"github.com/TTraveller7/invokerlib/pkg/consts"
+)
+
+// BatchStateStore is implemented by state stores that read and write many keys in one round trip.
+type BatchStateStore interface {
+	StateStore
+
+	// MultiGet returns the values of keys. Keys that do not exist are not in the result.
+	MultiGet(ctx context.Context, keys []string) (map[string][]byte, error)
+
+	// MultiPut puts the values of kvs, which do not expire.
+	MultiPut(ctx context.Context, kvs map[string][]byte) error
+
+	// MultiDelete deletes keys. Keys that do not exist are skipped.
+	MultiDelete(ctx context.Context, keys []string) error
+}
+
+// AsBatchStateStore returns s as a BatchStateStore if the state store behind it supports batches.
+func AsBatchStateStore(s StateStore) (BatchStateStore, bool) {
+	if _, ok := underlying(s).(BatchStateStore); !ok {
+		return nil, false
+	}
+	bs, ok := s.(BatchStateStore)
+	return bs, ok
+}
+
+// MultiGet returns the values of keys in s, in one batch if s supports batches, or one key at a time otherwise.
+func MultiGet(ctx context.Context, s StateStore, keys []string) (map[string][]byte, error) {
+	if bs, ok := AsBatchStateStore(s); ok {
+		return bs.MultiGet(ctx, keys)
+	}
+	return getEach(ctx, s, keys)
+}
+
+// MultiPut puts the values of kvs in s, in one batch if s supports batches, or one key at a time otherwise.
+func MultiPut(ctx context.Context, s StateStore, kvs map[string][]byte) error {
+	if bs, ok := AsBatchStateStore(s); ok {
+		return bs.MultiPut(ctx, kvs)
+	}
+	return putEach(ctx, s, kvs)
+}
+
+// MultiDelete deletes keys in s, in one batch if s supports batches, or one key at a time otherwise.
+func MultiDelete(ctx context.Context, s StateStore, keys []string) error {
+	if bs, ok := AsBatchStateStore(s); ok {
+		return bs.MultiDelete(ctx, keys)
+	}
+	return deleteEach(ctx, s, keys)
+}
+
+// getEach, putEach and deleteEach implement batches one key at a time, for local caches where a batch saves no
+// round trip.
+func getEach(ctx context.Context, s StateStore, keys []string) (map[string][]byte, error) {
+	res := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		val, err := s.Get(ctx, key)
+		if err == consts.ErrStateStoreKeyNotExist {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		res[key] = val
+	}
+	return res, nil
+}
+
+func putEach(ctx context.Context, s StateStore, kvs map[string][]byte) error {
+	for key, val := range kvs {
+		if err := s.Put(ctx, key, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteEach(ctx context.Context, s StateStore, keys []string) error {
+	for _, key := range keys {
+		if err := s.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package state
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/TTraveller7/invokerlib/pkg/consts"
+	"github.com/TTraveller7/invokerlib/pkg/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMultiGet(t *testing.T) {
+	ctx := context.Background()
+	s, _ := NewFreeCacheStateStore()
+	ns := NewNamespacedStateStore(s, Namespace("p", "batch", "freecache"))
+	wrapper := NewStateStoreWrapper(s, utils.NewMetricsClient("batch_test"))
+	for _, key := range []string{"a", "b"} {
+		s.Put(ctx, key, []byte("v-"+key))
+		ns.Put(ctx, key, []byte("ns-"+key))
+	}
+	tests := []struct {
+		name string
+		s    StateStore
+		keys []string
+		want map[string][]byte
+	}{
+		{
+			name: "per key",
+			s:    &plainStateStore{s},
+			keys: []string{"a", "missing", "b"},
+			want: map[string][]byte{"a": []byte("v-a"), "b": []byte("v-b")},
+		},
+		{
+			name: "batch",
+			s:    s,
+			keys: []string{"a", "missing"},
+			want: map[string][]byte{"a": []byte("v-a")},
+		},
+		{
+			name: "namespaced",
+			s:    ns,
+			keys: []string{"a", "b", "missing"},
+			want: map[string][]byte{"a": []byte("ns-a"), "b": []byte("ns-b")},
+		},
+		{
+			name: "wrapper",
+			s:    wrapper,
+			keys: []string{"b", "missing"},
+			want: map[string][]byte{"b": []byte("v-b")},
+		},
+		{
+			name: "empty",
+			s:    ns,
+			keys: []string{},
+			want: map[string][]byte{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MultiGet(ctx, tt.s, tt.keys)
+			if err != nil {
+				t.Fatalf("MultiGet() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MultiGet() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMultiPutAndDelete(t *testing.T) {
+	ctx := context.Background()
+	s, _ := NewFreeCacheStateStore()
+	tests := []struct {
+		name string
+		s    StateStore
+	}{
+		{name: "per key", s: &plainStateStore{s}},
+		{name: "namespaced", s: NewNamespacedStateStore(s, Namespace("p", "batch", "freecache"))},
+		{name: "wrapper", s: NewStateStoreWrapper(s, utils.NewMetricsClient("batch_put_test"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kvs := map[string][]byte{tt.name + "-a": []byte("a"), tt.name + "-b": []byte("b")}
+			if err := MultiPut(ctx, tt.s, kvs); err != nil {
+				t.Fatalf("MultiPut() error = %v", err)
+			}
+			for key, val := range kvs {
+				if got, err := tt.s.Get(ctx, key); err != nil || !reflect.DeepEqual(got, val) {
+					t.Errorf("Get(%s) = %s, %v, want %s", key, got, err, val)
+				}
+			}
+			if err := MultiDelete(ctx, tt.s, []string{tt.name + "-a", tt.name + "-missing"}); err != nil {
+				t.Fatalf("MultiDelete() error = %v", err)
+			}
+			if _, err := tt.s.Get(ctx, tt.name+"-a"); err != consts.ErrStateStoreKeyNotExist {
+				t.Errorf("Get() of deleted key error = %v, want %v", err, consts.ErrStateStoreKeyNotExist)
+			}
+			if _, err := tt.s.Get(ctx, tt.name+"-b"); err != nil {
+				t.Errorf("Get() of kept key error = %v", err)
+			}
+		})
+	}
+}
+
+func TestRedisStateStore_EmptyBatch(t *testing.T) {
+	ctx := context.Background()
+	// an empty batch returns before reaching the server, which does not exist
+	r := &RedisStateStore{cli: redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})}
+	if got, err := r.MultiGet(ctx, nil); err != nil || len(got) != 0 {
+		t.Errorf("MultiGet() = %v, %v, want empty", got, err)
+	}
+	if err := r.MultiPut(ctx, map[string][]byte{}); err != nil {
+		t.Errorf("MultiPut() error = %v", err)
+	}
+	if err := r.MultiDelete(ctx, nil); err != nil {
+		t.Errorf("MultiDelete() error = %v", err)
+	}
+}
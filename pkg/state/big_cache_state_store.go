@@ -3,6 +3,8 @@ package state
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/TTraveller7/invokerlib/pkg/consts"
 	"github.com/allegro/bigcache/v3"
@@ -11,6 +13,9 @@ import (
 type BigCacheStateStore struct {
 	StateStore
 	cli *bigcache.BigCache
+
+	// mu serializes collection updates
+	mu sync.Mutex
 }
 
 func NewBigCacheStateStore() (StateStore, error) {
@@ -67,8 +72,9 @@ func (b *BigCacheStateStore) Put(ctx context.Context, key string, val []byte) er
 	return nil
 }
 
+// PutWithExpireTime ignores expireSeconds, since entries of big cache share the same life window, which is not set.
 func (b *BigCacheStateStore) PutWithExpireTime(ctx context.Context, key string, val []byte, expireSeconds int) error {
-	panic("PutWithExpireTime is not implemented by BigCacheStateStore")
+	return b.Put(ctx, key, val)
 }
 
 func (b *BigCacheStateStore) Delete(ctx context.Context, key string) error {
@@ -79,26 +85,78 @@ func (b *BigCacheStateStore) Delete(ctx context.Context, key string) error {
 }
 
 func (b *BigCacheStateStore) Keys(ctx context.Context, limit int) ([]string, error) {
-	keys := make([]string, 0)
-	if b.cli.Len() == 0 {
-		return keys, nil
-	}
-
-	l := limit
-	if limit == 0 {
-		l = b.cli.Len()
-	}
+	return ScanKeys(ctx, b, "", limit)
+}
 
+// Scan walks the entries of the cache, and the cursor is the number of entries walked.
+func (b *BigCacheStateStore) Scan(ctx context.Context, prefix string, cursor uint64, count int) ([]string, uint64, error) {
 	iter := b.cli.Iterator()
-	for i := 0; i < l; i++ {
+	if count <= 0 {
+		count = consts.DefaultScanCount
+	}
+	keys := make([]string, 0)
+	var walked uint64
+	for iter.SetNext() {
+		walked++
+		if walked <= cursor {
+			continue
+		}
 		entry, err := iter.Value()
 		if err != nil {
-			return nil, err
+			return nil, 0, fmt.Errorf("big cache state store Scan failed: %v", err)
+		}
+		if strings.HasPrefix(entry.Key(), prefix) {
+			keys = append(keys, entry.Key())
 		}
-		keys = append(keys, entry.Key())
-		if !iter.SetNext() {
-			break
+		if len(keys) >= count {
+			return keys, walked, nil
 		}
 	}
-	return keys, nil
+	return keys, 0, nil
+}
+
+func (b *BigCacheStateStore) Append(ctx context.Context, key string, val []byte) error {
+	return b.AppendWithExpireTime(ctx, key, val, 0)
+}
+
+func (b *BigCacheStateStore) AppendWithExpireTime(ctx context.Context, key string, val []byte, expireSeconds int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return appendElement(ctx, b, key, val, expireSeconds)
+}
+
+func (b *BigCacheStateStore) SetAdd(ctx context.Context, key string, member []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return addMember(ctx, b, key, member)
+}
+
+func (b *BigCacheStateStore) SetRemove(ctx context.Context, key string, member []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return removeMember(ctx, b, key, member)
+}
+
+func (b *BigCacheStateStore) SetMembers(ctx context.Context, key string) ([][]byte, error) {
+	return readElements(ctx, b, key)
+}
+
+func (b *BigCacheStateStore) ListRange(ctx context.Context, key string, start int, stop int) ([][]byte, error) {
+	elements, err := readElements(ctx, b, key)
+	if err != nil {
+		return nil, err
+	}
+	return listRange(elements, start, stop), nil
+}
+
+func (b *BigCacheStateStore) MultiGet(ctx context.Context, keys []string) (map[string][]byte, error) {
+	return getEach(ctx, b, keys)
+}
+
+func (b *BigCacheStateStore) MultiPut(ctx context.Context, kvs map[string][]byte) error {
+	return putEach(ctx, b, kvs)
+}
+
+func (b *BigCacheStateStore) MultiDelete(ctx context.Context, keys []string) error {
+	return deleteEach(ctx, b, keys)
 }
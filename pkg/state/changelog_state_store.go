@@ -0,0 +1,500 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/TTraveller7/invokerlib/pkg/conf"
+	"github.com/TTraveller7/invokerlib/pkg/consts"
+	"github.com/TTraveller7/invokerlib/pkg/utils"
+)
+
+// changelogLocks is the number of locks that serialize writes to keys of a ChangelogStateStore.
+const changelogLocks = 64
+
+// changelogList and changelogSet are the values of the collection header of changelog records of elements.
+const (
+	changelogList = "list"
+	changelogSet  = "set"
+)
+
+// ChangelogStateStore backs a local state store with a compacted changelog topic. After each write, the value of
+// the key is sent to the changelog keyed by the state store key, or a tombstone if the key is deleted, so the last
+// record of each key in the changelog is the value of the key. Writes to the same key are serialized, so records
+// of a key are sent in the order of the writes.
+//
+// A write with a context from WithPartition is sent to the changelog partition with the number of the input
+// partition, so a worker restores the keys of the input partitions it claims. Other writes are partitioned by key.
+//
+// Collections are sent one element at a time, keyed by the element, which is its index in a list or the member in
+// a set, so the changelog does not grow with the size of a collection on each write. A removed member and the
+// elements of a deleted collection are sent as tombstones. Records of a key and of its elements are in the same
+// partition. Elements of a collection that is overwritten by Put are not removed from the changelog, so a
+// collection should be deleted before its key is reused for a value.
+type ChangelogStateStore struct {
+	StateStore
+	s     StateStore
+	topic string
+
+	client   sarama.Client
+	producer sarama.SyncProducer
+	locks    [changelogLocks]sync.Mutex
+}
+
+func NewChangelogStateStore(s StateStore, kc *conf.KafkaConfig) (*ChangelogStateStore, error) {
+	config := sarama.NewConfig()
+	config.Version = sarama.V2_0_0_0
+	config.Producer.Return.Successes = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Partitioner = newChangelogPartitioner
+	config.Consumer.IsolationLevel = sarama.ReadCommitted
+	config.Consumer.Return.Errors = true
+	client, err := sarama.NewClient([]string{kc.Address}, config)
+	if err != nil {
+		return nil, fmt.Errorf("create kafka client failed: %v", err)
+	}
+	producer, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("create changelog producer failed: %v", err)
+	}
+	return &ChangelogStateStore{
+		s:        s,
+		topic:    kc.Topic,
+		client:   client,
+		producer: producer,
+	}, nil
+}
+
+// WithPartition returns a context whose writes to a ChangelogStateStore are sent to the changelog partition with
+// the number of the input partition.
+func WithPartition(ctx context.Context, partition int32) context.Context {
+	return context.WithValue(ctx, consts.CTX_KEY_INVOKER_LIB_PARTITION, partition)
+}
+
+// changelogTarget is the metadata of a changelog record, which tells its partition.
+type changelogTarget struct {
+	key          string
+	partition    int32
+	hasPartition bool
+}
+
+func newChangelogTarget(ctx context.Context, key string) changelogTarget {
+	partition, hasPartition := ctx.Value(consts.CTX_KEY_INVOKER_LIB_PARTITION).(int32)
+	return changelogTarget{
+		key:          key,
+		partition:    partition,
+		hasPartition: hasPartition,
+	}
+}
+
+// changelogPartitioner partitions changelog records by the input partition in their metadata, or by the state store
+// key if there is none, so records of the elements of a collection are in the partition of the collection key.
+type changelogPartitioner struct {
+	sarama.Partitioner
+}
+
+func newChangelogPartitioner(topic string) sarama.Partitioner {
+	return &changelogPartitioner{Partitioner: sarama.NewHashPartitioner(topic)}
+}
+
+func (p *changelogPartitioner) Partition(msg *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	target, _ := msg.Metadata.(changelogTarget)
+	if !target.hasPartition {
+		return p.Partitioner.Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder(target.key)}, numPartitions)
+	}
+	if target.partition < 0 || target.partition >= numPartitions {
+		return -1, fmt.Errorf("changelog has %v partitions, which is less than input partition %v", numPartitions,
+			target.partition)
+	}
+	return target.partition, nil
+}
+
+// Restore applies partitions of the changelog to the local state store. Keys that have expired are deleted. It
+// must not be called with partitions that are being written.
+func (c *ChangelogStateStore) Restore(ctx context.Context, partitions []int32) error {
+	consumer, err := sarama.NewConsumerFromClient(c.client)
+	if err != nil {
+		return fmt.Errorf("create changelog consumer failed: %v", err)
+	}
+	defer consumer.Close()
+	changelogPartitions, err := c.client.Partitions(c.topic)
+	if err != nil {
+		return fmt.Errorf("get partitions of changelog %s failed: %v", c.topic, err)
+	}
+	for _, partition := range partitions {
+		if int(partition) >= len(changelogPartitions) {
+			return fmt.Errorf("changelog %s has %v partitions, which is less than input partition %v", c.topic,
+				len(changelogPartitions), partition)
+		}
+		if err := c.restorePartition(ctx, consumer, partition); err != nil {
+			return fmt.Errorf("restore partition %v of changelog %s failed: %v", partition, c.topic, err)
+		}
+	}
+	return nil
+}
+
+// restorePartition applies records of a partition up to the newest offset at the time of the call.
+func (c *ChangelogStateStore) restorePartition(ctx context.Context, consumer sarama.Consumer,
+	partition int32) error {
+
+	oldest, err := c.client.GetOffset(c.topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return err
+	}
+	newest, err := c.client.GetOffset(c.topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return err
+	}
+	if oldest >= newest {
+		return nil
+	}
+	pc, err := consumer.ConsumePartition(c.topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+
+	catchUp := utils.NewCatchUp(newest, consts.CatchUpIdleMs*time.Millisecond,
+		consts.CatchUpFirstRecordTimeoutMs*time.Millisecond)
+	ticker := time.NewTicker(consts.CatchUpCheckIntervalMs * time.Millisecond)
+	defer ticker.Stop()
+	expired := make(map[string]*expiredList, 0)
+	for {
+		select {
+		case msg := <-pc.Messages():
+			if err := c.apply(ctx, msg, expired); err != nil {
+				return fmt.Errorf("apply record at offset %v failed: %v", msg.Offset, err)
+			}
+			if catchUp.Consumed(msg.Offset) {
+				return nil
+			}
+		case err := <-pc.Errors():
+			return err
+		case <-ticker.C:
+			if catchUp.Idle() {
+				return nil
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// expiredList holds the expired elements of a list read from the changelog, which are applied if a later element
+// of the list is appended before the list expires.
+type expiredList struct {
+	elements [][]byte
+	expireAt int64
+}
+
+func (c *ChangelogStateStore) apply(ctx context.Context, msg *sarama.ConsumerMessage,
+	expired map[string]*expiredList) error {
+
+	key := string(msg.Key)
+	collection := ""
+	expireAt := int64(0)
+	for _, h := range msg.Headers {
+		switch string(h.Key) {
+		case consts.ChangelogHeaderKey:
+			key = string(h.Value)
+		case consts.ChangelogHeaderCollection:
+			collection = string(h.Value)
+		case consts.ChangelogHeaderExpireAt:
+			var err error
+			if expireAt, err = strconv.ParseInt(string(h.Value), 10, 64); err != nil {
+				return fmt.Errorf("parse expire time %s failed: %v", string(h.Value), err)
+			}
+		}
+	}
+	expireSeconds := int(expireAt - time.Now().Unix())
+	switch collection {
+	case changelogList:
+		return c.applyListElement(ctx, key, msg, expireAt, expired)
+	case changelogSet:
+		return c.applySetElement(ctx, key, msg)
+	}
+	delete(expired, key)
+	if msg.Value == nil || (expireAt != 0 && expireSeconds <= 0) {
+		return c.s.Delete(ctx, key)
+	}
+	if expireAt == 0 {
+		return c.s.Put(ctx, key, msg.Value)
+	}
+	return c.s.PutWithExpireTime(ctx, key, msg.Value, expireSeconds)
+}
+
+// applyListElement appends an element to a list. An expired element is held until a later element of the list is
+// appended before it expires, since each append extends the expiration of the whole list.
+func (c *ChangelogStateStore) applyListElement(ctx context.Context, key string, msg *sarama.ConsumerMessage,
+	expireAt int64, expired map[string]*expiredList) error {
+
+	// elements of a deleted list are removed with the list
+	if msg.Value == nil {
+		return nil
+	}
+	cs, ok := c.s.(CollectionStateStore)
+	if !ok {
+		return ErrNotImplemented
+	}
+	held, exists := expired[key]
+	if exists && held.expireAt < msg.Timestamp.Unix() {
+		held, exists = nil, false
+	}
+	expireSeconds := int(expireAt - time.Now().Unix())
+	if expireAt != 0 && expireSeconds <= 0 {
+		if !exists {
+			held = &expiredList{}
+		}
+		held.elements = append(held.elements, msg.Value)
+		held.expireAt = expireAt
+		expired[key] = held
+		return nil
+	}
+	delete(expired, key)
+	if exists {
+		for _, e := range held.elements {
+			if err := cs.AppendWithExpireTime(ctx, key, e, expireSeconds); err != nil {
+				return err
+			}
+		}
+	}
+	return cs.AppendWithExpireTime(ctx, key, msg.Value, expireSeconds)
+}
+
+// applySetElement adds a member to a set, or removes it if the record is a tombstone.
+func (c *ChangelogStateStore) applySetElement(ctx context.Context, key string, msg *sarama.ConsumerMessage) error {
+	cs, ok := c.s.(CollectionStateStore)
+	if !ok {
+		return ErrNotImplemented
+	}
+	if msg.Value != nil {
+		return cs.SetAdd(ctx, key, msg.Value)
+	}
+	// a removal does not create a set that does not exist
+	if _, err := c.s.Get(ctx, key); err == consts.ErrStateStoreKeyNotExist {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return cs.SetRemove(ctx, key, msg.Key[len(elementKey(key, changelogSet, nil)):])
+}
+
+func (c *ChangelogStateStore) Close() error {
+	if err := c.producer.Close(); err != nil {
+		return err
+	}
+	return c.client.Close()
+}
+
+func (c *ChangelogStateStore) lock(key string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &c.locks[h.Sum32()%changelogLocks]
+}
+
+// elementKey returns the changelog key of an element of the collection at key, where id is the index of a list
+// element or a set member.
+func elementKey(key string, collection string, id []byte) []byte {
+	res := make([]byte, 0, len(key)+len(collection)+len(id)+2)
+	res = append(res, key...)
+	res = append(res, 0)
+	res = append(res, collection...)
+	res = append(res, 0)
+	return append(res, id...)
+}
+
+// record returns the changelog record of the value of key, or a tombstone if val is nil.
+func (c *ChangelogStateStore) record(ctx context.Context, key string, val []byte,
+	expireSeconds int) *sarama.ProducerMessage {
+
+	msg := &sarama.ProducerMessage{
+		Topic:    c.topic,
+		Key:      sarama.StringEncoder(key),
+		Metadata: newChangelogTarget(ctx, key),
+	}
+	if val != nil {
+		msg.Value = sarama.ByteEncoder(val)
+	}
+	if expireSeconds > 0 {
+		expireAt := time.Now().Unix() + int64(expireSeconds)
+		msg.Headers = []sarama.RecordHeader{{
+			Key:   []byte(consts.ChangelogHeaderExpireAt),
+			Value: []byte(strconv.FormatInt(expireAt, 10)),
+		}}
+	}
+	return msg
+}
+
+// elementRecord returns the changelog record of an element of the collection at key, or a tombstone if val is nil.
+func (c *ChangelogStateStore) elementRecord(ctx context.Context, key string, collection string, id []byte,
+	val []byte, expireSeconds int) *sarama.ProducerMessage {
+
+	msg := c.record(ctx, key, val, expireSeconds)
+	msg.Key = sarama.ByteEncoder(elementKey(key, collection, id))
+	msg.Headers = append(msg.Headers,
+		sarama.RecordHeader{Key: []byte(consts.ChangelogHeaderKey), Value: []byte(key)},
+		sarama.RecordHeader{Key: []byte(consts.ChangelogHeaderCollection), Value: []byte(collection)},
+	)
+	return msg
+}
+
+func (c *ChangelogStateStore) send(msgs ...*sarama.ProducerMessage) error {
+	var err error
+	if len(msgs) == 1 {
+		_, _, err = c.producer.SendMessage(msgs[0])
+	} else {
+		err = c.producer.SendMessages(msgs)
+	}
+	if err != nil {
+		return fmt.Errorf("send to changelog %s failed: %v", c.topic, err)
+	}
+	return nil
+}
+
+func (c *ChangelogStateStore) Get(ctx context.Context, key string) ([]byte, error) {
+	return c.s.Get(ctx, key)
+}
+
+func (c *ChangelogStateStore) Put(ctx context.Context, key string, val []byte) error {
+	return c.PutWithExpireTime(ctx, key, val, 0)
+}
+
+func (c *ChangelogStateStore) PutWithExpireTime(ctx context.Context, key string, val []byte, expireSeconds int) error {
+	l := c.lock(key)
+	l.Lock()
+	defer l.Unlock()
+	if err := putWithExpireTime(ctx, c.s, key, val, expireSeconds); err != nil {
+		return err
+	}
+	// a nil value would be taken as a tombstone
+	if val == nil {
+		val = []byte{}
+	}
+	return c.send(c.record(ctx, key, val, expireSeconds))
+}
+
+// Delete sends tombstones of the key and of the elements of the collection at key. A value that is not a
+// collection has no elements, and the value of a key does not tell whether it is a list or a set, so tombstones of
+// both are sent.
+func (c *ChangelogStateStore) Delete(ctx context.Context, key string) error {
+	l := c.lock(key)
+	l.Lock()
+	defer l.Unlock()
+	elements, err := readElements(ctx, c.s, key)
+	if err != nil {
+		elements = nil
+	}
+	if err := c.s.Delete(ctx, key); err != nil {
+		return err
+	}
+	msgs := []*sarama.ProducerMessage{c.record(ctx, key, nil, 0)}
+	for i, e := range elements {
+		msgs = append(msgs,
+			c.elementRecord(ctx, key, changelogList, []byte(strconv.Itoa(i)), nil, 0),
+			c.elementRecord(ctx, key, changelogSet, e, nil, 0))
+	}
+	return c.send(msgs...)
+}
+
+func (c *ChangelogStateStore) Keys(ctx context.Context, limit int) ([]string, error) {
+	return c.s.Keys(ctx, limit)
+}
+
+func (c *ChangelogStateStore) Scan(ctx context.Context, prefix string, cursor uint64, count int) ([]string, uint64, error) {
+	return c.s.Scan(ctx, prefix, cursor, count)
+}
+
+// Collection operations return ErrNotImplemented if the local state store does not implement
+// CollectionStateStore. Each write sends the element that is written to the changelog.
+func (c *ChangelogStateStore) Append(ctx context.Context, key string, val []byte) error {
+	return c.AppendWithExpireTime(ctx, key, val, 0)
+}
+
+func (c *ChangelogStateStore) AppendWithExpireTime(ctx context.Context, key string, val []byte, expireSeconds int) error {
+	return c.updateCollection(key, func(cs CollectionStateStore) error {
+		if err := cs.AppendWithExpireTime(ctx, key, val, expireSeconds); err != nil {
+			return err
+		}
+		elements, err := cs.ListRange(ctx, key, 0, -1)
+		if err != nil {
+			return err
+		}
+		// a nil value would be taken as a tombstone
+		if val == nil {
+			val = []byte{}
+		}
+		id := []byte(strconv.Itoa(len(elements) - 1))
+		return c.send(c.elementRecord(ctx, key, changelogList, id, val, expireSeconds))
+	})
+}
+
+func (c *ChangelogStateStore) SetAdd(ctx context.Context, key string, member []byte) error {
+	return c.updateCollection(key, func(cs CollectionStateStore) error {
+		if err := cs.SetAdd(ctx, key, member); err != nil {
+			return err
+		}
+		if member == nil {
+			member = []byte{}
+		}
+		return c.send(c.elementRecord(ctx, key, changelogSet, member, member, 0))
+	})
+}
+
+func (c *ChangelogStateStore) SetRemove(ctx context.Context, key string, member []byte) error {
+	return c.updateCollection(key, func(cs CollectionStateStore) error {
+		if err := cs.SetRemove(ctx, key, member); err != nil {
+			return err
+		}
+		return c.send(c.elementRecord(ctx, key, changelogSet, member, nil, 0))
+	})
+}
+
+func (c *ChangelogStateStore) SetMembers(ctx context.Context, key string) ([][]byte, error) {
+	cs, ok := c.s.(CollectionStateStore)
+	if !ok {
+		return nil, ErrNotImplemented
+	}
+	return cs.SetMembers(ctx, key)
+}
+
+func (c *ChangelogStateStore) ListRange(ctx context.Context, key string, start int, stop int) ([][]byte, error) {
+	cs, ok := c.s.(CollectionStateStore)
+	if !ok {
+		return nil, ErrNotImplemented
+	}
+	return cs.ListRange(ctx, key, start, stop)
+}
+
+func (c *ChangelogStateStore) updateCollection(key string, update func(cs CollectionStateStore) error) error {
+	cs, ok := c.s.(CollectionStateStore)
+	if !ok {
+		return ErrNotImplemented
+	}
+	l := c.lock(key)
+	l.Lock()
+	defer l.Unlock()
+	return update(cs)
+}
+
+// Batch operations write keys one at a time, since each key is sent to the changelog.
+func (c *ChangelogStateStore) MultiGet(ctx context.Context, keys []string) (map[string][]byte, error) {
+	return getEach(ctx, c.s, keys)
+}
+
+func (c *ChangelogStateStore) MultiPut(ctx context.Context, kvs map[string][]byte) error {
+	return putEach(ctx, c, kvs)
+}
+
+func (c *ChangelogStateStore) MultiDelete(ctx context.Context, keys []string) error {
+	return deleteEach(ctx, c, keys)
+}
+
+func (c *ChangelogStateStore) unwrap() StateStore {
+	return c.s
+}
@@ -0,0 +1,327 @@
+package state
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/TTraveller7/invokerlib/pkg/consts"
+)
+
+func TestChangelogPartitioner(t *testing.T) {
+	c := &ChangelogStateStore{topic: "changelog"}
+	p := newChangelogPartitioner("changelog")
+	tests := []struct {
+		name          string
+		ctx           context.Context
+		wantPartition int32
+		wantErr       bool
+	}{
+		{name: "by key", ctx: context.Background(), wantPartition: -1},
+		{name: "input partition", ctx: WithPartition(context.Background(), 5), wantPartition: 5},
+		{name: "input partition out of range", ctx: WithPartition(context.Background(), 16), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"a", "b", "word-count"} {
+				want, err := p.Partition(c.record(tt.ctx, key, []byte("v"), 0), 16)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Partition() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if err != nil {
+					continue
+				}
+				if tt.wantPartition >= 0 && want != tt.wantPartition {
+					t.Errorf("Partition() = %v, want %v", want, tt.wantPartition)
+				}
+				// elements of a collection are in the partition of the collection key
+				for _, msg := range []*sarama.ProducerMessage{
+					c.elementRecord(tt.ctx, key, changelogList, []byte("0"), []byte("v"), 0),
+					c.elementRecord(tt.ctx, key, changelogSet, []byte("v"), nil, 0),
+				} {
+					got, err := p.Partition(msg, 16)
+					if err != nil {
+						t.Fatalf("Partition() error = %v", err)
+					}
+					if got != want {
+						t.Errorf("Partition() of element of %s = %v, want %v", key, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+// changelogMessage returns a changelog record as read by Restore. The record is an element of a collection if
+// collection is not empty. expireAt is omitted if it is 0.
+func changelogMessage(key string, collection string, id string, val []byte, expireAt int64,
+	timestamp time.Time) *sarama.ConsumerMessage {
+
+	msg := &sarama.ConsumerMessage{
+		Key:       []byte(key),
+		Value:     val,
+		Timestamp: timestamp,
+	}
+	if collection != "" {
+		msg.Key = elementKey(key, collection, []byte(id))
+		msg.Headers = append(msg.Headers,
+			&sarama.RecordHeader{Key: []byte(consts.ChangelogHeaderKey), Value: []byte(key)},
+			&sarama.RecordHeader{Key: []byte(consts.ChangelogHeaderCollection), Value: []byte(collection)})
+	}
+	if expireAt != 0 {
+		msg.Headers = append(msg.Headers, &sarama.RecordHeader{
+			Key:   []byte(consts.ChangelogHeaderExpireAt),
+			Value: []byte(strconv.FormatInt(expireAt, 10)),
+		})
+	}
+	return msg
+}
+
+// toConsumerMessage returns a record sent to the changelog as it is read back.
+func toConsumerMessage(t *testing.T, msg *sarama.ProducerMessage) *sarama.ConsumerMessage {
+	key, err := msg.Key.Encode()
+	if err != nil {
+		t.Fatalf("encode key failed: %v", err)
+	}
+	res := &sarama.ConsumerMessage{Key: key, Timestamp: time.Now()}
+	if msg.Value != nil {
+		if res.Value, err = msg.Value.Encode(); err != nil {
+			t.Fatalf("encode value failed: %v", err)
+		}
+	}
+	for i := range msg.Headers {
+		res.Headers = append(res.Headers, &msg.Headers[i])
+	}
+	return res
+}
+
+func TestChangelogStateStore_Apply(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	past, future := now.Unix()-100, now.Unix()+100
+	type want struct {
+		key     string
+		value   string
+		list    []string
+		set     []string
+		missing bool
+	}
+	tests := []struct {
+		name string
+		msgs []*sarama.ConsumerMessage
+		want want
+	}{
+		{
+			name: "value",
+			msgs: []*sarama.ConsumerMessage{
+				changelogMessage("k", "", "", []byte("a"), 0, now),
+				changelogMessage("k", "", "", []byte("b"), 0, now),
+			},
+			want: want{key: "k", value: "b"},
+		},
+		{
+			name: "tombstone",
+			msgs: []*sarama.ConsumerMessage{
+				changelogMessage("k", "", "", []byte("a"), 0, now),
+				changelogMessage("k", "", "", nil, 0, now),
+			},
+			want: want{key: "k", missing: true},
+		},
+		{
+			name: "expired value",
+			msgs: []*sarama.ConsumerMessage{
+				changelogMessage("k", "", "", []byte("a"), 0, now),
+				changelogMessage("k", "", "", []byte("b"), past, now),
+			},
+			want: want{key: "k", missing: true},
+		},
+		{
+			name: "value expiring later",
+			msgs: []*sarama.ConsumerMessage{changelogMessage("k", "", "", []byte("a"), future, now)},
+			want: want{key: "k", value: "a"},
+		},
+		{
+			name: "list",
+			msgs: []*sarama.ConsumerMessage{
+				changelogMessage("l", changelogList, "0", []byte("a"), 0, now),
+				changelogMessage("l", changelogList, "1", []byte("b"), 0, now),
+			},
+			want: want{key: "l", list: []string{"a", "b"}},
+		},
+		{
+			name: "list extended before it expires",
+			msgs: []*sarama.ConsumerMessage{
+				changelogMessage("l", changelogList, "0", []byte("a"), now.Unix()-10, now.Add(-100*time.Second)),
+				changelogMessage("l", changelogList, "1", []byte("b"), future, now.Add(-50*time.Second)),
+			},
+			want: want{key: "l", list: []string{"a", "b"}},
+		},
+		{
+			name: "list relisted after it expires",
+			msgs: []*sarama.ConsumerMessage{
+				changelogMessage("l", changelogList, "1", []byte("a"), now.Unix()-60, now.Add(-200*time.Second)),
+				changelogMessage("l", changelogList, "2", []byte("b"), now.Unix()-50, now.Add(-150*time.Second)),
+				changelogMessage("l", changelogList, "0", []byte("c"), future, now.Add(-10*time.Second)),
+			},
+			want: want{key: "l", list: []string{"c"}},
+		},
+		{
+			name: "expired list",
+			msgs: []*sarama.ConsumerMessage{
+				changelogMessage("l", changelogList, "0", []byte("a"), past, now.Add(-200*time.Second)),
+			},
+			want: want{key: "l", missing: true},
+		},
+		{
+			name: "list element tombstone",
+			msgs: []*sarama.ConsumerMessage{
+				changelogMessage("l", changelogList, "0", []byte("a"), 0, now),
+				changelogMessage("l", "", "", nil, 0, now),
+				changelogMessage("l", changelogList, "0", nil, 0, now),
+			},
+			want: want{key: "l", missing: true},
+		},
+		{
+			name: "set member removed",
+			msgs: []*sarama.ConsumerMessage{
+				changelogMessage("s", changelogSet, "x", []byte("x"), 0, now),
+				changelogMessage("s", changelogSet, "y", []byte("y"), 0, now),
+				changelogMessage("s", changelogSet, "x", nil, 0, now),
+			},
+			want: want{key: "s", set: []string{"y"}},
+		},
+		{
+			name: "member removed from missing set",
+			msgs: []*sarama.ConsumerMessage{changelogMessage("s", changelogSet, "x", nil, 0, now)},
+			want: want{key: "s", missing: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local, _ := NewFreeCacheStateStore()
+			c := &ChangelogStateStore{s: local}
+			expired := make(map[string]*expiredList, 0)
+			for _, msg := range tt.msgs {
+				if err := c.apply(ctx, msg, expired); err != nil {
+					t.Fatalf("apply() error = %v", err)
+				}
+			}
+			checkState(t, local, tt.want.key, tt.want.value, tt.want.list, tt.want.set, tt.want.missing)
+		})
+	}
+}
+
+// checkState checks the value, list or set at key, or that key is missing.
+func checkState(t *testing.T, s StateStore, key string, value string, list []string, set []string, missing bool) {
+	t.Helper()
+	ctx := context.Background()
+	val, err := s.Get(ctx, key)
+	if missing {
+		if err != consts.ErrStateStoreKeyNotExist {
+			t.Errorf("Get(%s) = %v, %v, want missing", key, val, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("Get(%s) error = %v", key, err)
+	}
+	cs := s.(CollectionStateStore)
+	switch {
+	case list != nil:
+		elements, err := cs.ListRange(ctx, key, 0, -1)
+		if err != nil {
+			t.Fatalf("ListRange() error = %v", err)
+		}
+		if got := toStrings(elements); !reflect.DeepEqual(got, list) {
+			t.Errorf("ListRange(%s) = %v, want %v", key, got, list)
+		}
+	case set != nil:
+		members, err := cs.SetMembers(ctx, key)
+		if err != nil {
+			t.Fatalf("SetMembers() error = %v", err)
+		}
+		got := toStrings(members)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, set) {
+			t.Errorf("SetMembers(%s) = %v, want %v", key, got, set)
+		}
+	default:
+		if string(val) != value {
+			t.Errorf("Get(%s) = %s, want %s", key, val, value)
+		}
+	}
+}
+
+func toStrings(elements [][]byte) []string {
+	res := make([]string, 0, len(elements))
+	for _, e := range elements {
+		res = append(res, string(e))
+	}
+	return res
+}
+
+func TestChangelogStateStore_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	config.Producer.Partitioner = newChangelogPartitioner
+	producer := mocks.NewSyncProducer(t, config)
+	sent := make([]*sarama.ProducerMessage, 0)
+	expect := func(n int) {
+		for i := 0; i < n; i++ {
+			producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+				sent = append(sent, msg)
+				return nil
+			})
+		}
+	}
+	local, _ := NewFreeCacheStateStore()
+	c := &ChangelogStateStore{s: local, topic: "changelog", producer: producer}
+
+	writes := []struct {
+		name     string
+		messages int
+		write    func() error
+	}{
+		{"put value", 1, func() error { return c.Put(ctx, "v", []byte("a")) }},
+		{"put deleted value", 1, func() error { return c.Put(ctx, "deleted", []byte("a")) }},
+		{"append", 1, func() error { return c.Append(ctx, "l", []byte("a")) }},
+		{"append again", 1, func() error { return c.Append(ctx, "l", []byte("b")) }},
+		{"add member", 1, func() error { return c.SetAdd(ctx, "s", []byte("x")) }},
+		{"add other member", 1, func() error { return c.SetAdd(ctx, "s", []byte("y")) }},
+		{"remove member", 1, func() error { return c.SetRemove(ctx, "s", []byte("x")) }},
+		{"append to deleted list", 1, func() error { return c.Append(ctx, "dl", []byte("a")) }},
+		{"append again to deleted list", 1, func() error { return c.Append(ctx, "dl", []byte("b")) }},
+		// the value, and tombstones of its elements as a list and as a set
+		{"delete value", 1, func() error { return c.Delete(ctx, "deleted") }},
+		{"delete list", 5, func() error { return c.Delete(ctx, "dl") }},
+	}
+	for _, w := range writes {
+		expect(w.messages)
+		if err := w.write(); err != nil {
+			t.Fatalf("%s failed: %v", w.name, err)
+		}
+	}
+	if err := producer.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	restored, _ := NewFreeCacheStateStore()
+	r := &ChangelogStateStore{s: restored}
+	expired := make(map[string]*expiredList, 0)
+	for _, msg := range sent {
+		if err := r.apply(ctx, toConsumerMessage(t, msg), expired); err != nil {
+			t.Fatalf("apply() error = %v", err)
+		}
+	}
+	checkState(t, restored, "v", "a", nil, nil, false)
+	checkState(t, restored, "deleted", "", nil, nil, true)
+	checkState(t, restored, "l", "", []string{"a", "b"}, nil, false)
+	checkState(t, restored, "s", "", nil, []string{"y"}, false)
+	checkState(t, restored, "dl", "", nil, nil, true)
+}
@@ -0,0 +1,81 @@
+package state
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+
+	"github.com/bytedance/sonic"
+)
+
+// Codec converts values of typed states to and from the bytes kept in a state store.
+type Codec[T any] interface {
+	Encode(v T) ([]byte, error)
+	Decode(b []byte) (T, error)
+}
+
+// JsonCodec encodes values with encoding/json.
+type JsonCodec[T any] struct{}
+
+func (JsonCodec[T]) Encode(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JsonCodec[T]) Decode(b []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(b, &v)
+	return v, err
+}
+
+// SonicCodec encodes values as json with sonic, which is faster than encoding/json.
+type SonicCodec[T any] struct{}
+
+func (SonicCodec[T]) Encode(v T) ([]byte, error) {
+	return sonic.Marshal(v)
+}
+
+func (SonicCodec[T]) Decode(b []byte) (T, error) {
+	var v T
+	err := sonic.Unmarshal(b, &v)
+	return v, err
+}
+
+// GobCodec encodes values with encoding/gob, which keeps unexported types of interface values if they are
+// registered with gob.Register.
+type GobCodec[T any] struct{}
+
+func (GobCodec[T]) Encode(v T) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec[T]) Decode(b []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(b)).Decode(&v)
+	return v, err
+}
+
+// RawCodec keeps bytes as they are.
+type RawCodec struct{}
+
+func (RawCodec) Encode(v []byte) ([]byte, error) {
+	return v, nil
+}
+
+func (RawCodec) Decode(b []byte) ([]byte, error) {
+	return b, nil
+}
+
+// StringCodec keeps strings as their bytes. It is usually the key codec of a MapState.
+type StringCodec struct{}
+
+func (StringCodec) Encode(v string) ([]byte, error) {
+	return []byte(v), nil
+}
+
+func (StringCodec) Decode(b []byte) (string, error) {
+	return string(b), nil
+}
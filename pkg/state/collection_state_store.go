@@ -0,0 +1,165 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/TTraveller7/invokerlib/pkg/consts"
+)
+
+// CollectionStateStore is implemented by state stores that update lists and sets in place, so concurrent writers
+// to the same key do not overwrite each other. A list or a set that does not exist is empty.
+type CollectionStateStore interface {
+	StateStore
+
+	// Append adds val to the end of the list at key.
+	Append(ctx context.Context, key string, val []byte) error
+
+	// AppendWithExpireTime adds val to the end of the list at key, and the list expires expireSeconds after the
+	// last append. 0 means the list does not expire.
+	AppendWithExpireTime(ctx context.Context, key string, val []byte, expireSeconds int) error
+
+	// SetAdd adds member to the set at key if it is not a member yet.
+	SetAdd(ctx context.Context, key string, member []byte) error
+
+	// SetRemove removes member from the set at key.
+	SetRemove(ctx context.Context, key string, member []byte) error
+
+	// SetMembers returns the members of the set at key in no particular order.
+	SetMembers(ctx context.Context, key string) ([][]byte, error)
+
+	// ListRange returns the elements of the list at key from start to stop, both inclusive. Negative indexes count
+	// from the end of the list, where -1 is the last element.
+	ListRange(ctx context.Context, key string, start int, stop int) ([][]byte, error)
+}
+
+// AsCollectionStateStore returns s as a CollectionStateStore if the state store behind it supports collections.
+func AsCollectionStateStore(s StateStore) (CollectionStateStore, bool) {
+	if _, ok := underlying(s).(CollectionStateStore); !ok {
+		return nil, false
+	}
+	cs, ok := s.(CollectionStateStore)
+	return cs, ok
+}
+
+// Stores without native collections keep a collection in a single value, where each element is prefixed by its
+// length as a uvarint.
+
+func encodeElement(val []byte) []byte {
+	buf := make([]byte, binary.MaxVarintLen64+len(val))
+	n := binary.PutUvarint(buf, uint64(len(val)))
+	n += copy(buf[n:], val)
+	return buf[:n]
+}
+
+func decodeElements(b []byte) ([][]byte, error) {
+	res := make([][]byte, 0)
+	for len(b) > 0 {
+		l, n := binary.Uvarint(b)
+		if n <= 0 || uint64(len(b)-n) < l {
+			return nil, fmt.Errorf("malformed collection element")
+		}
+		res = append(res, b[n:n+int(l)])
+		b = b[n+int(l):]
+	}
+	return res, nil
+}
+
+func encodeElements(elements [][]byte) []byte {
+	res := make([]byte, 0)
+	for _, e := range elements {
+		res = append(res, encodeElement(e)...)
+	}
+	return res
+}
+
+func removeElement(elements [][]byte, e []byte) [][]byte {
+	res := make([][]byte, 0, len(elements))
+	for _, x := range elements {
+		if !bytes.Equal(x, e) {
+			res = append(res, x)
+		}
+	}
+	return res
+}
+
+// distinctElements removes repeated elements, keeping the first occurrence of each.
+func distinctElements(elements [][]byte) [][]byte {
+	res := make([][]byte, 0, len(elements))
+	for _, e := range elements {
+		if !containsElement(res, e) {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+func containsElement(elements [][]byte, e []byte) bool {
+	for _, x := range elements {
+		if bytes.Equal(x, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// listRange returns elements[start:stop+1] with the index semantics of ListRange.
+func listRange(elements [][]byte, start int, stop int) [][]byte {
+	if start < 0 {
+		start += len(elements)
+	}
+	if stop < 0 {
+		stop += len(elements)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= len(elements) {
+		stop = len(elements) - 1
+	}
+	if start > stop {
+		return [][]byte{}
+	}
+	return elements[start : stop+1]
+}
+
+// appendElement, addMember and readElements keep a collection in a single value of s. Callers must serialize
+// updates to the same key.
+func appendElement(ctx context.Context, s StateStore, key string, val []byte, expireSeconds int) error {
+	old, err := s.Get(ctx, key)
+	if err != nil && err != consts.ErrStateStoreKeyNotExist {
+		return err
+	}
+	return s.PutWithExpireTime(ctx, key, append(old, encodeElement(val)...), expireSeconds)
+}
+
+func addMember(ctx context.Context, s StateStore, key string, member []byte) error {
+	members, err := readElements(ctx, s, key)
+	if err != nil {
+		return err
+	}
+	if containsElement(members, member) {
+		return nil
+	}
+	return appendElement(ctx, s, key, member, 0)
+}
+
+func removeMember(ctx context.Context, s StateStore, key string, member []byte) error {
+	members, err := readElements(ctx, s, key)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, key, encodeElements(removeElement(members, member)))
+}
+
+func readElements(ctx context.Context, s StateStore, key string) ([][]byte, error) {
+	val, err := s.Get(ctx, key)
+	if err == consts.ErrStateStoreKeyNotExist {
+		return [][]byte{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return decodeElements(val)
+}
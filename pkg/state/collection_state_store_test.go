@@ -0,0 +1,158 @@
+package state
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeElements(t *testing.T) {
+	long := make([]byte, 300)
+	tests := []struct {
+		name     string
+		elements [][]byte
+	}{
+		{name: "empty", elements: [][]byte{}},
+		{name: "one", elements: [][]byte{[]byte("a")}},
+		{name: "empty element", elements: [][]byte{{}, []byte("b")}},
+		{name: "multi-byte length", elements: [][]byte{long, []byte("c")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeElements(encodeElements(tt.elements))
+			if err != nil {
+				t.Fatalf("decodeElements() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.elements) {
+				t.Errorf("decodeElements() = %v, want %v", got, tt.elements)
+			}
+		})
+	}
+}
+
+func TestDecodeElements_Malformed(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{name: "truncated element", b: []byte{3, 'a'}},
+		{name: "truncated length", b: []byte{0x80}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeElements(tt.b); err == nil {
+				t.Errorf("decodeElements() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestListRange(t *testing.T) {
+	elements := [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d")}
+	tests := []struct {
+		name  string
+		start int
+		stop  int
+		want  []string
+	}{
+		{name: "all", start: 0, stop: -1, want: []string{"a", "b", "c", "d"}},
+		{name: "middle", start: 1, stop: 2, want: []string{"b", "c"}},
+		{name: "last", start: -1, stop: -1, want: []string{"d"}},
+		{name: "negative", start: -3, stop: -2, want: []string{"b", "c"}},
+		{name: "start before first", start: -10, stop: 1, want: []string{"a", "b"}},
+		{name: "stop after last", start: 2, stop: 10, want: []string{"c", "d"}},
+		{name: "start after stop", start: 3, stop: 1, want: []string{}},
+		{name: "start after last", start: 5, stop: 10, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make([]string, 0)
+			for _, e := range listRange(elements, tt.start, tt.stop) {
+				got = append(got, string(e))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listRange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDistinctElements(t *testing.T) {
+	elements := [][]byte{[]byte("b"), []byte("a"), []byte("b"), {}, []byte("a"), {}}
+	want := [][]byte{[]byte("b"), []byte("a"), {}}
+	if got := distinctElements(elements); !reflect.DeepEqual(got, want) {
+		t.Errorf("distinctElements() = %v, want %v", got, want)
+	}
+}
+
+func TestLocalCollections(t *testing.T) {
+	freeCache, err := NewFreeCacheStateStore()
+	if err != nil {
+		t.Fatalf("NewFreeCacheStateStore() error = %v", err)
+	}
+	bigCache, err := NewBigCacheStateStore()
+	if err != nil {
+		t.Fatalf("NewBigCacheStateStore() error = %v", err)
+	}
+	type op struct {
+		add    bool
+		member string
+	}
+	tests := []struct {
+		name string
+		ops  []op
+		want []string
+	}{
+		{name: "add", ops: []op{{true, "a"}, {true, "b"}}, want: []string{"a", "b"}},
+		{name: "add twice", ops: []op{{true, "a"}, {true, "a"}, {true, "b"}}, want: []string{"a", "b"}},
+		{name: "remove", ops: []op{{true, "a"}, {true, "b"}, {false, "a"}}, want: []string{"b"}},
+		{name: "remove missing", ops: []op{{true, "a"}, {false, "c"}}, want: []string{"a"}},
+		{name: "add after remove", ops: []op{{true, "a"}, {false, "a"}, {true, "a"}}, want: []string{"a"}},
+	}
+	ctx := context.Background()
+	for storeName, s := range map[string]StateStore{"freecache": freeCache, "bigcache": bigCache} {
+		cs := s.(CollectionStateStore)
+		for _, tt := range tests {
+			t.Run(storeName+" "+tt.name, func(t *testing.T) {
+				key := tt.name
+				for _, o := range tt.ops {
+					var err error
+					if o.add {
+						err = cs.SetAdd(ctx, key, []byte(o.member))
+					} else {
+						err = cs.SetRemove(ctx, key, []byte(o.member))
+					}
+					if err != nil {
+						t.Fatalf("update set failed: %v", err)
+					}
+				}
+				members, err := cs.SetMembers(ctx, key)
+				if err != nil {
+					t.Fatalf("SetMembers() error = %v", err)
+				}
+				got := make([]string, 0)
+				for _, m := range members {
+					got = append(got, string(m))
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("SetMembers() = %v, want %v", got, tt.want)
+				}
+			})
+		}
+		t.Run(storeName+" list", func(t *testing.T) {
+			for _, e := range []string{"a", "b", "a"} {
+				if err := cs.Append(ctx, "list", []byte(e)); err != nil {
+					t.Fatalf("Append() error = %v", err)
+				}
+			}
+			elements, err := cs.ListRange(ctx, "list", 0, -1)
+			if err != nil {
+				t.Fatalf("ListRange() error = %v", err)
+			}
+			want := [][]byte{[]byte("a"), []byte("b"), []byte("a")}
+			if !reflect.DeepEqual(elements, want) {
+				t.Errorf("ListRange() = %v, want %v", elements, want)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package state
 
 import (
 	"context"
+	"strings"
+	"sync"
 
 	"github.com/TTraveller7/invokerlib/pkg/consts"
 	"github.com/coocood/freecache"
@@ -10,6 +12,9 @@ import (
 type FreeCacheStateStore struct {
 	StateStore
 	cli *freecache.Cache
+
+	// mu serializes collection updates
+	mu sync.Mutex
 }
 
 func NewFreeCacheStateStore() (StateStore, error) {
@@ -45,19 +50,77 @@ func (f *FreeCacheStateStore) Delete(ctx context.Context, key string) error {
 }
 
 func (f *FreeCacheStateStore) Keys(ctx context.Context, limit int) ([]string, error) {
-	iter := f.cli.NewIterator()
-	keys := make([]string, 0)
+	return ScanKeys(ctx, f, "", limit)
+}
 
-	l := limit
-	if l == 0 {
-		l = int(f.cli.EntryCount())
+// Scan walks the entries of the cache, and the cursor is the number of entries walked.
+func (f *FreeCacheStateStore) Scan(ctx context.Context, prefix string, cursor uint64, count int) ([]string, uint64, error) {
+	iter := f.cli.NewIterator()
+	if count <= 0 {
+		count = consts.DefaultScanCount
 	}
-	for i := 0; i < l; i++ {
+	keys := make([]string, 0)
+	var walked uint64
+	for {
 		entry := iter.Next()
 		if entry == nil {
-			break
+			return keys, 0, nil
+		}
+		walked++
+		if walked <= cursor {
+			continue
+		}
+		if strings.HasPrefix(string(entry.Key), prefix) {
+			keys = append(keys, string(entry.Key))
+		}
+		if len(keys) >= count {
+			return keys, walked, nil
 		}
-		keys = append(keys, string(entry.Key))
 	}
-	return keys, nil
+}
+
+func (f *FreeCacheStateStore) Append(ctx context.Context, key string, val []byte) error {
+	return f.AppendWithExpireTime(ctx, key, val, 0)
+}
+
+func (f *FreeCacheStateStore) AppendWithExpireTime(ctx context.Context, key string, val []byte, expireSeconds int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return appendElement(ctx, f, key, val, expireSeconds)
+}
+
+func (f *FreeCacheStateStore) SetAdd(ctx context.Context, key string, member []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return addMember(ctx, f, key, member)
+}
+
+func (f *FreeCacheStateStore) SetRemove(ctx context.Context, key string, member []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return removeMember(ctx, f, key, member)
+}
+
+func (f *FreeCacheStateStore) SetMembers(ctx context.Context, key string) ([][]byte, error) {
+	return readElements(ctx, f, key)
+}
+
+func (f *FreeCacheStateStore) ListRange(ctx context.Context, key string, start int, stop int) ([][]byte, error) {
+	elements, err := readElements(ctx, f, key)
+	if err != nil {
+		return nil, err
+	}
+	return listRange(elements, start, stop), nil
+}
+
+func (f *FreeCacheStateStore) MultiGet(ctx context.Context, keys []string) (map[string][]byte, error) {
+	return getEach(ctx, f, keys)
+}
+
+func (f *FreeCacheStateStore) MultiPut(ctx context.Context, kvs map[string][]byte) error {
+	return putEach(ctx, f, kvs)
+}
+
+func (f *FreeCacheStateStore) MultiDelete(ctx context.Context, keys []string) error {
+	return deleteEach(ctx, f, keys)
 }
@@ -4,6 +4,11 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/TTraveller7/invokerlib/pkg/conf"
 	"github.com/TTraveller7/invokerlib/pkg/consts"
@@ -13,16 +18,23 @@ import (
 type MemcachedStateStore struct {
 	StateStore
 	cli *memcache.Client
+
+	// keyIndex keeps the keys of the store in the shards of a key index, which are read by Scan
+	keyIndex bool
 }
 
 func NewMemcachedStateStore(name string) (StateStore, error) {
 	mc := conf.GetMemcachedConfigByName(name)
+	if mc == nil {
+		return nil, fmt.Errorf("memcached config with name %s not found", name)
+	}
 	cli := memcache.New(mc.Addresses...)
 	if err := cli.Ping(); err != nil {
 		return nil, err
 	} else {
 		return &MemcachedStateStore{
-			cli: cli,
+			cli:      cli,
+			keyIndex: mc.KeyIndex,
 		}, nil
 	}
 }
@@ -50,21 +62,429 @@ func (m *MemcachedStateStore) PutWithExpireTime(ctx context.Context, key string,
 		Value:      val,
 		Expiration: int32(expireSeconds),
 	}
-	if err := m.cli.Set(item); err != nil {
+	if !m.keyIndex {
+		return m.cli.Set(item)
+	}
+
+	// a key is added to the index only if it is new
+	err := m.cli.Add(item)
+	if err == memcache.ErrNotStored {
+		return m.cli.Set(item)
+	} else if err != nil {
 		return err
-	} else {
-		return nil
 	}
+	m.indexKey(key, expireSeconds)
+	return nil
 }
 
 func (m *MemcachedStateStore) Delete(ctx context.Context, key string) error {
-	if err := m.cli.Delete(key); err != nil && err != memcache.ErrCacheMiss {
+	base64Key := base64.StdEncoding.EncodeToString([]byte(key))
+	if err := m.cli.Delete(base64Key); err != nil && err != memcache.ErrCacheMiss {
 		return err
-	} else {
-		return nil
 	}
+	if m.keyIndex {
+		m.unindexKey(key)
+	}
+	return nil
 }
 
 func (m *MemcachedStateStore) Keys(ctx context.Context, limit int) ([]string, error) {
-	return nil, ErrNotImplemented
+	return ScanKeys(ctx, m, "", limit)
+}
+
+// Scan reads the key index, and returns ErrNotImplemented if the store has no key index. The cursor is the number
+// of keys with prefix returned, in order. Expired keys are pruned from the index when a scan starts, and may be
+// returned by the scan.
+func (m *MemcachedStateStore) Scan(ctx context.Context, prefix string, cursor uint64, count int) ([]string, uint64, error) {
+	if !m.keyIndex {
+		return nil, 0, ErrNotImplemented
+	}
+	if count <= 0 {
+		count = consts.DefaultScanCount
+	}
+	shards, err := m.readIndex()
+	if err != nil {
+		return nil, 0, err
+	}
+	now := time.Now().Unix()
+	seen := make(map[string]bool, 0)
+	keys := make([]string, 0)
+	for shard, entries := range shards {
+		hasExpired := false
+		for _, e := range entries {
+			hasExpired = hasExpired || e.expired(now)
+			if !seen[e.key] && strings.HasPrefix(e.key, prefix) {
+				seen[e.key] = true
+				keys = append(keys, e.key)
+			}
+		}
+		if cursor == 0 && hasExpired {
+			if err := m.pruneShard(shard); err != nil {
+				logs.Printf("memcached state store prune key index shard %v failed: %v", shard, err)
+			}
+		}
+	}
+	sort.Strings(keys)
+	if cursor >= uint64(len(keys)) {
+		return []string{}, 0, nil
+	}
+	end := cursor + uint64(count)
+	if end >= uint64(len(keys)) {
+		return keys[cursor:], 0, nil
+	}
+	return keys[cursor:end], end, nil
+}
+
+// indexEntry is an entry of the key index. expireAt is the unix time the key expires at when it is indexed, or 0 if
+// it does not expire. The expiration of a key may be changed later, so a key is checked before it is pruned.
+type indexEntry struct {
+	key      string
+	expireAt int64
+}
+
+func newIndexEntry(key string, expireSeconds int) indexEntry {
+	e := indexEntry{key: key}
+	if expireSeconds > 0 {
+		e.expireAt = time.Now().Unix() + int64(expireSeconds)
+	}
+	return e
+}
+
+func (e indexEntry) expired(now int64) bool {
+	return e.expireAt != 0 && e.expireAt <= now
+}
+
+func encodeIndexEntries(entries []indexEntry) []byte {
+	res := make([]byte, 0)
+	for _, e := range entries {
+		res = append(res, encodeElement([]byte(strconv.FormatInt(e.expireAt, 10)+":"+e.key))...)
+	}
+	return res
+}
+
+func decodeIndexEntries(b []byte) ([]indexEntry, error) {
+	elements, err := decodeElements(b)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]indexEntry, 0, len(elements))
+	for _, element := range elements {
+		expireAt, key, found := strings.Cut(string(element), ":")
+		if !found {
+			return nil, fmt.Errorf("malformed key index entry")
+		}
+		e := indexEntry{key: key}
+		if e.expireAt, err = strconv.ParseInt(expireAt, 10, 64); err != nil {
+			return nil, fmt.Errorf("malformed key index entry: %v", err)
+		}
+		res = append(res, e)
+	}
+	return res, nil
+}
+
+func indexShardOf(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % consts.MemcachedKeyIndexShards)
+}
+
+func indexShardKey(shard int) string {
+	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s-%d", consts.MemcachedKeyIndexKey, shard)))
+}
+
+// readIndex returns the entries of each shard of the key index.
+func (m *MemcachedStateStore) readIndex() (map[int][]indexEntry, error) {
+	shardKeys := make([]string, 0, consts.MemcachedKeyIndexShards)
+	shardOf := make(map[string]int, consts.MemcachedKeyIndexShards)
+	for shard := 0; shard < consts.MemcachedKeyIndexShards; shard++ {
+		shardKeys = append(shardKeys, indexShardKey(shard))
+		shardOf[indexShardKey(shard)] = shard
+	}
+	items, err := m.cli.GetMulti(shardKeys)
+	if err != nil {
+		return nil, fmt.Errorf("memcached state store read key index failed: %v", err)
+	}
+	res := make(map[int][]indexEntry, len(items))
+	for shardKey, item := range items {
+		entries, err := decodeIndexEntries(item.Value)
+		if err != nil {
+			return nil, err
+		}
+		res[shardOf[shardKey]] = entries
+	}
+	return res, nil
+}
+
+// indexKey adds key to its shard of the key index. If the shard cannot be appended to, which happens when it
+// reaches the item size, expired keys are pruned from the shard and the append is retried once. The key is stored
+// whether or not it is indexed, so an indexing failure is logged instead of failing the write.
+func (m *MemcachedStateStore) indexKey(key string, expireSeconds int) {
+	shard := indexShardOf(key)
+	item := &memcache.Item{
+		Key:   indexShardKey(shard),
+		Value: encodeIndexEntries([]indexEntry{newIndexEntry(key, expireSeconds)}),
+	}
+	_, err := m.appendItem(item)
+	if err != nil {
+		if pruneErr := m.pruneShard(shard); pruneErr == nil {
+			_, err = m.appendItem(item)
+		}
+	}
+	if err != nil {
+		logs.Printf("memcached state store index key %s failed: %v", key, err)
+	}
+}
+
+// unindexKey removes key from its shard of the key index. The key is deleted whether or not it is removed, so a
+// failure is logged instead of failing the delete.
+func (m *MemcachedStateStore) unindexKey(key string) {
+	err := m.updateShard(indexShardOf(key), func(entries []indexEntry) ([]indexEntry, error) {
+		res := make([]indexEntry, 0, len(entries))
+		for _, e := range entries {
+			if e.key != key {
+				res = append(res, e)
+			}
+		}
+		return res, nil
+	})
+	if err != nil {
+		logs.Printf("memcached state store unindex key %s failed: %v", key, err)
+	}
+}
+
+// pruneShard removes expired keys that no longer exist from a shard, and merges repeated entries of a key into its
+// last entry.
+func (m *MemcachedStateStore) pruneShard(shard int) error {
+	return m.updateShard(shard, func(entries []indexEntry) ([]indexEntry, error) {
+		now := time.Now().Unix()
+		keys := make([]string, 0, len(entries))
+		lastEntry := make(map[string]indexEntry, len(entries))
+		for _, e := range entries {
+			if _, exists := lastEntry[e.key]; !exists {
+				keys = append(keys, e.key)
+			}
+			lastEntry[e.key] = e
+		}
+		expiredKeys := make([]string, 0)
+		for _, key := range keys {
+			if lastEntry[key].expired(now) {
+				expiredKeys = append(expiredKeys, base64.StdEncoding.EncodeToString([]byte(key)))
+			}
+		}
+		existing := make(map[string]*memcache.Item, 0)
+		if len(expiredKeys) > 0 {
+			var err error
+			if existing, err = m.cli.GetMulti(expiredKeys); err != nil {
+				return nil, err
+			}
+		}
+		res := make([]indexEntry, 0, len(keys))
+		for _, key := range keys {
+			e := lastEntry[key]
+			if _, exists := existing[base64.StdEncoding.EncodeToString([]byte(key))]; e.expired(now) && !exists {
+				continue
+			}
+			res = append(res, e)
+		}
+		return res, nil
+	})
+}
+
+// updateShard rewrites a shard of the key index with compare and swap, and is retried if the shard is changed by
+// another writer in between. update only removes entries, so the shard is not rewritten if none is removed.
+func (m *MemcachedStateStore) updateShard(shard int,
+	update func(entries []indexEntry) ([]indexEntry, error)) error {
+
+	for {
+		item, err := m.cli.Get(indexShardKey(shard))
+		if err == memcache.ErrCacheMiss {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		entries, err := decodeIndexEntries(item.Value)
+		if err != nil {
+			return err
+		}
+		updated, err := update(entries)
+		if err != nil {
+			return err
+		}
+		if len(updated) == len(entries) {
+			return nil
+		}
+		item.Value = encodeIndexEntries(updated)
+		err = m.cli.CompareAndSwap(item)
+		if err == memcache.ErrCASConflict {
+			continue
+		} else if err == memcache.ErrNotStored {
+			return nil
+		}
+		return err
+	}
+}
+
+func (m *MemcachedStateStore) Append(ctx context.Context, key string, val []byte) error {
+	return m.AppendWithExpireTime(ctx, key, val, 0)
+}
+
+// AppendWithExpireTime uses memcached append, and adds the key if it does not exist. Another writer may add the key
+// at the same time, in which case append is retried. Memcached append keeps the expiration of the key, so the key
+// is touched after append.
+func (m *MemcachedStateStore) AppendWithExpireTime(ctx context.Context, key string, val []byte, expireSeconds int) error {
+	item := &memcache.Item{
+		Key:        base64.StdEncoding.EncodeToString([]byte(key)),
+		Value:      encodeElement(val),
+		Expiration: int32(expireSeconds),
+	}
+	added, err := m.appendItem(item)
+	if err != nil {
+		return err
+	}
+	if added {
+		if m.keyIndex {
+			m.indexKey(key, expireSeconds)
+		}
+		return nil
+	}
+	if expireSeconds > 0 {
+		return m.cli.Touch(item.Key, item.Expiration)
+	}
+	return nil
+}
+
+// appendItem appends the value of item to its key, or adds the key if it does not exist, and returns true if the
+// key is added.
+func (m *MemcachedStateStore) appendItem(item *memcache.Item) (bool, error) {
+	for {
+		err := m.cli.Append(item)
+		if err == nil {
+			return false, nil
+		}
+		if err != memcache.ErrNotStored {
+			return false, err
+		}
+		err = m.cli.Add(item)
+		if err == nil {
+			return true, nil
+		} else if err != memcache.ErrNotStored {
+			return false, err
+		}
+	}
+}
+
+// SetAdd appends member to the set with compare and swap if it is not a member yet, so the set grows with distinct
+// members only. It is retried if the set is changed by another writer in between.
+func (m *MemcachedStateStore) SetAdd(ctx context.Context, key string, member []byte) error {
+	base64Key := base64.StdEncoding.EncodeToString([]byte(key))
+	for {
+		item, err := m.cli.Get(base64Key)
+		if err == memcache.ErrCacheMiss {
+			err = m.cli.Add(&memcache.Item{
+				Key:   base64Key,
+				Value: encodeElement(member),
+			})
+			if err == memcache.ErrNotStored {
+				continue
+			} else if err != nil {
+				return fmt.Errorf("memcached state store SetAdd failed: %v", err)
+			}
+			if m.keyIndex {
+				m.indexKey(key, 0)
+			}
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("memcached state store SetAdd failed: %v", err)
+		}
+		elements, err := decodeElements(item.Value)
+		if err != nil {
+			return err
+		}
+		if containsElement(elements, member) {
+			return nil
+		}
+		item.Value = append(item.Value, encodeElement(member)...)
+		err = m.cli.CompareAndSwap(item)
+		if err == memcache.ErrCASConflict || err == memcache.ErrNotStored {
+			// the set is changed or deleted by another writer
+			continue
+		} else if err != nil {
+			return fmt.Errorf("memcached state store SetAdd failed: %v", err)
+		}
+		return nil
+	}
+}
+
+// SetRemove rewrites the set without member with compare and swap, and is retried if the set is changed by another
+// writer in between.
+func (m *MemcachedStateStore) SetRemove(ctx context.Context, key string, member []byte) error {
+	return m.compareAndRemove(base64.StdEncoding.EncodeToString([]byte(key)), member)
+}
+
+func (m *MemcachedStateStore) compareAndRemove(base64Key string, member []byte) error {
+	for {
+		item, err := m.cli.Get(base64Key)
+		if err == memcache.ErrCacheMiss {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("memcached state store SetRemove failed: %v", err)
+		}
+		elements, err := decodeElements(item.Value)
+		if err != nil {
+			return err
+		}
+		item.Value = encodeElements(removeElement(elements, member))
+		err = m.cli.CompareAndSwap(item)
+		if err == memcache.ErrCASConflict {
+			continue
+		} else if err == memcache.ErrNotStored {
+			return nil
+		}
+		return err
+	}
+}
+
+func (m *MemcachedStateStore) SetMembers(ctx context.Context, key string) ([][]byte, error) {
+	elements, err := readElements(ctx, m, key)
+	if err != nil {
+		return nil, err
+	}
+	return distinctElements(elements), nil
+}
+
+func (m *MemcachedStateStore) ListRange(ctx context.Context, key string, start int, stop int) ([][]byte, error) {
+	elements, err := readElements(ctx, m, key)
+	if err != nil {
+		return nil, err
+	}
+	return listRange(elements, start, stop), nil
+}
+
+func (m *MemcachedStateStore) MultiGet(ctx context.Context, keys []string) (map[string][]byte, error) {
+	base64Keys := make([]string, 0, len(keys))
+	keyOf := make(map[string]string, len(keys))
+	for _, key := range keys {
+		base64Key := base64.StdEncoding.EncodeToString([]byte(key))
+		base64Keys = append(base64Keys, base64Key)
+		keyOf[base64Key] = key
+	}
+	items, err := m.cli.GetMulti(base64Keys)
+	if err != nil {
+		return nil, fmt.Errorf("memcached state store MultiGet failed: %v", err)
+	}
+	res := make(map[string][]byte, len(items))
+	for base64Key, item := range items {
+		res[keyOf[base64Key]] = item.Value
+	}
+	return res, nil
+}
+
+// MultiPut sets keys one at a time, since memcached has no multi set command.
+func (m *MemcachedStateStore) MultiPut(ctx context.Context, kvs map[string][]byte) error {
+	return putEach(ctx, m, kvs)
+}
+
+// MultiDelete deletes keys one at a time, since memcached has no multi delete command.
+func (m *MemcachedStateStore) MultiDelete(ctx context.Context, keys []string) error {
+	return deleteEach(ctx, m, keys)
 }
@@ -0,0 +1,178 @@
+package state
+
+import (
+	"context"
+	"strings"
+
+	"github.com/TTraveller7/invokerlib/pkg/conf"
+)
+
+// NamespacedStateStore prefixes the keys of another state store with a namespace, so state stores shared by
+// processors do not mix their keys. Keys and Scan only return keys in the namespace, without the namespace.
+type NamespacedStateStore struct {
+	StateStore
+	s         StateStore
+	namespace string
+}
+
+func NewNamespacedStateStore(s StateStore, namespace string) *NamespacedStateStore {
+	return &NamespacedStateStore{
+		s:         s,
+		namespace: namespace,
+	}
+}
+
+// Namespace returns the namespace of the state store with name in a processor, which is
+// "<pipeline>/<processor>/<store>/". The pipeline is omitted if it is empty.
+func Namespace(pipeline string, processor string, store string) string {
+	parts := make([]string, 0, 3)
+	if pipeline != "" {
+		parts = append(parts, pipeline)
+	}
+	parts = append(parts, processor, store)
+	return strings.Join(parts, "/") + "/"
+}
+
+// processorNamespace returns the namespace of the state store with name in the processor that is running.
+func processorNamespace(name string) string {
+	return Namespace(conf.Config().PipelineName, conf.Config().Name, name)
+}
+
+func (n *NamespacedStateStore) key(key string) string {
+	return n.namespace + key
+}
+
+func (n *NamespacedStateStore) keys(keys []string) []string {
+	res := make([]string, 0, len(keys))
+	for _, key := range keys {
+		res = append(res, n.key(key))
+	}
+	return res
+}
+
+func (n *NamespacedStateStore) Get(ctx context.Context, key string) ([]byte, error) {
+	return n.s.Get(ctx, n.key(key))
+}
+
+func (n *NamespacedStateStore) Put(ctx context.Context, key string, val []byte) error {
+	return n.s.Put(ctx, n.key(key), val)
+}
+
+func (n *NamespacedStateStore) PutWithExpireTime(ctx context.Context, key string, val []byte, expireSeconds int) error {
+	return n.s.PutWithExpireTime(ctx, n.key(key), val, expireSeconds)
+}
+
+func (n *NamespacedStateStore) Delete(ctx context.Context, key string) error {
+	return n.s.Delete(ctx, n.key(key))
+}
+
+func (n *NamespacedStateStore) Keys(ctx context.Context, limit int) ([]string, error) {
+	return ScanKeys(ctx, n, "", limit)
+}
+
+func (n *NamespacedStateStore) Scan(ctx context.Context, prefix string, cursor uint64, count int) ([]string, uint64, error) {
+	keys, next, err := n.s.Scan(ctx, n.key(prefix), cursor, count)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, n.namespace)
+	}
+	return keys, next, nil
+}
+
+// DeleteAll deletes all keys in the namespace.
+func (n *NamespacedStateStore) DeleteAll(ctx context.Context) error {
+	// keys are scanned before any is deleted, since deletes may move the cursor of a scan
+	keys, err := ScanKeys(ctx, n.s, n.namespace, 0)
+	if err != nil {
+		return err
+	}
+	return MultiDelete(ctx, n.s, keys)
+}
+
+// Collection and batch operations return ErrNotImplemented if the wrapped state store does not implement them.
+// Use AsCollectionStateStore and AsBatchStateStore to check it.
+func (n *NamespacedStateStore) Append(ctx context.Context, key string, val []byte) error {
+	return n.AppendWithExpireTime(ctx, key, val, 0)
+}
+
+func (n *NamespacedStateStore) AppendWithExpireTime(ctx context.Context, key string, val []byte, expireSeconds int) error {
+	cs, ok := n.s.(CollectionStateStore)
+	if !ok {
+		return ErrNotImplemented
+	}
+	return cs.AppendWithExpireTime(ctx, n.key(key), val, expireSeconds)
+}
+
+func (n *NamespacedStateStore) SetAdd(ctx context.Context, key string, member []byte) error {
+	cs, ok := n.s.(CollectionStateStore)
+	if !ok {
+		return ErrNotImplemented
+	}
+	return cs.SetAdd(ctx, n.key(key), member)
+}
+
+func (n *NamespacedStateStore) SetRemove(ctx context.Context, key string, member []byte) error {
+	cs, ok := n.s.(CollectionStateStore)
+	if !ok {
+		return ErrNotImplemented
+	}
+	return cs.SetRemove(ctx, n.key(key), member)
+}
+
+func (n *NamespacedStateStore) SetMembers(ctx context.Context, key string) ([][]byte, error) {
+	cs, ok := n.s.(CollectionStateStore)
+	if !ok {
+		return nil, ErrNotImplemented
+	}
+	return cs.SetMembers(ctx, n.key(key))
+}
+
+func (n *NamespacedStateStore) ListRange(ctx context.Context, key string, start int, stop int) ([][]byte, error) {
+	cs, ok := n.s.(CollectionStateStore)
+	if !ok {
+		return nil, ErrNotImplemented
+	}
+	return cs.ListRange(ctx, n.key(key), start, stop)
+}
+
+func (n *NamespacedStateStore) MultiGet(ctx context.Context, keys []string) (map[string][]byte, error) {
+	bs, ok := n.s.(BatchStateStore)
+	if !ok {
+		return nil, ErrNotImplemented
+	}
+	vals, err := bs.MultiGet(ctx, n.keys(keys))
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string][]byte, len(vals))
+	for key, val := range vals {
+		res[strings.TrimPrefix(key, n.namespace)] = val
+	}
+	return res, nil
+}
+
+func (n *NamespacedStateStore) MultiPut(ctx context.Context, kvs map[string][]byte) error {
+	bs, ok := n.s.(BatchStateStore)
+	if !ok {
+		return ErrNotImplemented
+	}
+	namespacedKvs := make(map[string][]byte, len(kvs))
+	for key, val := range kvs {
+		namespacedKvs[n.key(key)] = val
+	}
+	return bs.MultiPut(ctx, namespacedKvs)
+}
+
+func (n *NamespacedStateStore) MultiDelete(ctx context.Context, keys []string) error {
+	bs, ok := n.s.(BatchStateStore)
+	if !ok {
+		return ErrNotImplemented
+	}
+	return bs.MultiDelete(ctx, n.keys(keys))
+}
+
+func (n *NamespacedStateStore) unwrap() StateStore {
+	return n.s
+}
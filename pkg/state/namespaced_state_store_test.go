@@ -0,0 +1,42 @@
+package state
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/TTraveller7/invokerlib/pkg/consts"
+)
+
+func TestNamespacedStateStore(t *testing.T) {
+	ctx := context.Background()
+	s, _ := NewFreeCacheStateStore()
+	a := NewNamespacedStateStore(s, Namespace("p", "a", "freecache"))
+	b := NewNamespacedStateStore(s, Namespace("p", "b", "freecache"))
+	a.Put(ctx, "k", []byte("a"))
+	b.Put(ctx, "k", []byte("b"))
+	if _, ok := AsCollectionStateStore(a); !ok {
+		t.Errorf("AsCollectionStateStore() = false, want true")
+	}
+
+	if val, _ := a.Get(ctx, "k"); string(val) != "a" {
+		t.Errorf("Get() = %s, want a", string(val))
+	}
+	keys, err := a.Keys(ctx, 0)
+	if err != nil {
+		t.Fatalf("Keys() error = %v", err)
+	}
+	if !reflect.DeepEqual(keys, []string{"k"}) {
+		t.Errorf("Keys() = %v, want [k]", keys)
+	}
+
+	if err := a.DeleteAll(ctx); err != nil {
+		t.Fatalf("DeleteAll() error = %v", err)
+	}
+	if _, err := a.Get(ctx, "k"); err != consts.ErrStateStoreKeyNotExist {
+		t.Errorf("Get() after DeleteAll error = %v, want %v", err, consts.ErrStateStoreKeyNotExist)
+	}
+	if val, _ := b.Get(ctx, "k"); string(val) != "b" {
+		t.Errorf("Get() of another namespace = %s, want b", string(val))
+	}
+}
@@ -3,6 +3,7 @@ package state
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/TTraveller7/invokerlib/pkg/conf"
@@ -43,6 +44,8 @@ func (r *RedisStateStore) Get(ctx context.Context, key string) ([]byte, error) {
 	strVal, err := r.cli.Get(ctx, key).Result()
 	if err == redis.Nil {
 		return nil, consts.ErrStateStoreKeyNotExist
+	} else if isWrongType(err) {
+		return nil, consts.ErrStateStoreWrongType
 	} else if err != nil {
 		return nil, fmt.Errorf("redis state store Get failed: %v", err)
 	} else {
@@ -69,12 +72,132 @@ func (r *RedisStateStore) Delete(ctx context.Context, key string) error {
 }
 
 func (r *RedisStateStore) Keys(ctx context.Context, limit int) ([]string, error) {
-	keys, err := r.cli.Keys(ctx, "*").Result()
+	return ScanKeys(ctx, r, "", limit)
+}
+
+// Scan uses SCAN MATCH, which does not block redis like KEYS does.
+func (r *RedisStateStore) Scan(ctx context.Context, prefix string, cursor uint64, count int) ([]string, uint64, error) {
+	keys, next, err := r.cli.Scan(ctx, cursor, escapeGlob(prefix)+"*", int64(count)).Result()
 	if err != nil {
-		return nil, err
+		return nil, 0, fmt.Errorf("redis state store Scan failed: %v", err)
+	}
+	return keys, next, nil
+}
+
+// escapeGlob escapes the characters of s that are special in redis glob patterns.
+func escapeGlob(s string) string {
+	var sb strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+func (r *RedisStateStore) Append(ctx context.Context, key string, val []byte) error {
+	return r.AppendWithExpireTime(ctx, key, val, 0)
+}
+
+func (r *RedisStateStore) AppendWithExpireTime(ctx context.Context, key string, val []byte, expireSeconds int) error {
+	pipe := r.cli.TxPipeline()
+	pipe.RPush(ctx, key, val)
+	if expireSeconds > 0 {
+		pipe.Expire(ctx, key, time.Duration(expireSeconds)*time.Second)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis state store Append failed: %v", err)
+	}
+	return nil
+}
+
+func (r *RedisStateStore) SetAdd(ctx context.Context, key string, member []byte) error {
+	if err := r.cli.SAdd(ctx, key, member).Err(); err != nil {
+		return fmt.Errorf("redis state store SetAdd failed: %v", err)
 	}
-	if len(keys) > consts.DefaultCatLimit {
-		keys = keys[:consts.DefaultCatLimit]
+	return nil
+}
+
+func (r *RedisStateStore) SetRemove(ctx context.Context, key string, member []byte) error {
+	if err := r.cli.SRem(ctx, key, member).Err(); err != nil {
+		return fmt.Errorf("redis state store SetRemove failed: %v", err)
 	}
-	return keys, nil
+	return nil
+}
+
+func (r *RedisStateStore) SetMembers(ctx context.Context, key string) ([][]byte, error) {
+	members, err := r.cli.SMembers(ctx, key).Result()
+	if isWrongType(err) {
+		return nil, consts.ErrStateStoreWrongType
+	} else if err != nil {
+		return nil, fmt.Errorf("redis state store SetMembers failed: %v", err)
+	}
+	return toByteSlices(members), nil
+}
+
+func (r *RedisStateStore) ListRange(ctx context.Context, key string, start int, stop int) ([][]byte, error) {
+	elements, err := r.cli.LRange(ctx, key, int64(start), int64(stop)).Result()
+	if isWrongType(err) {
+		return nil, consts.ErrStateStoreWrongType
+	} else if err != nil {
+		return nil, fmt.Errorf("redis state store ListRange failed: %v", err)
+	}
+	return toByteSlices(elements), nil
+}
+
+// isWrongType returns true if err is returned for a command on a key of another type, such as GET on a list.
+func isWrongType(err error) bool {
+	return err != nil && redis.HasErrorPrefix(err, "WRONGTYPE")
+}
+
+func toByteSlices(strs []string) [][]byte {
+	res := make([][]byte, len(strs))
+	for i, str := range strs {
+		res[i] = []byte(str)
+	}
+	return res
+}
+
+func (r *RedisStateStore) MultiGet(ctx context.Context, keys []string) (map[string][]byte, error) {
+	res := make(map[string][]byte, len(keys))
+	if len(keys) == 0 {
+		return res, nil
+	}
+	vals, err := r.cli.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis state store MultiGet failed: %v", err)
+	}
+	for i, val := range vals {
+		// missing keys are nil
+		if str, ok := val.(string); ok {
+			res[keys[i]] = []byte(str)
+		}
+	}
+	return res, nil
+}
+
+func (r *RedisStateStore) MultiPut(ctx context.Context, kvs map[string][]byte) error {
+	if len(kvs) == 0 {
+		return nil
+	}
+	pairs := make([]interface{}, 0, 2*len(kvs))
+	for key, val := range kvs {
+		pairs = append(pairs, key, val)
+	}
+	if err := r.cli.MSet(ctx, pairs...).Err(); err != nil {
+		return fmt.Errorf("redis state store MultiPut failed: %v", err)
+	}
+	return nil
+}
+
+func (r *RedisStateStore) MultiDelete(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := r.cli.Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("redis state store MultiDelete failed: %v", err)
+	}
+	return nil
 }
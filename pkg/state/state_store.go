@@ -3,24 +3,118 @@ package state
 import (
 	"context"
 	"fmt"
+	"log"
+	"os"
+
+	"github.com/TTraveller7/invokerlib/pkg/conf"
+	"github.com/TTraveller7/invokerlib/pkg/consts"
 )
 
 var ErrNotImplemented error = fmt.Errorf("not Implemented")
 
+var logs *log.Logger = log.New(os.Stdout, "", log.LstdFlags|log.Lshortfile)
+
 type StateStore interface {
 	Get(ctx context.Context, key string) ([]byte, error)
 	Put(ctx context.Context, key string, val []byte) error
 	PutWithExpireTime(ctx context.Context, key string, val []byte, expireSeconds int) error
 	Delete(ctx context.Context, key string) error
 	Keys(ctx context.Context, limit int) ([]string, error)
+
+	// Scan returns keys with prefix from cursor, and the cursor to continue from, which is 0 when the scan is done.
+	// A scan starts from cursor 0. count is a hint of the number of keys returned. Keys added or deleted during a
+	// scan may be missed, and a key may be returned more than once.
+	Scan(ctx context.Context, prefix string, cursor uint64, count int) ([]string, uint64, error)
 }
 
 var stateStores map[string]StateStore = make(map[string]StateStore, 0)
 
+// AddStateStore registers a state store of the processor with name. Keys of the state store are put in the
+// namespace of the store in the processor, unless it is namespaced already.
 func AddStateStore(name string, stateStore StateStore) {
+	if !isNamespaced(stateStore) {
+		stateStore = NewNamespacedStateStore(stateStore, processorNamespace(name))
+	}
 	stateStores[name] = stateStore
 }
 
+// StateStores returns the state stores registered by the processor, which only show the keys of the processor.
 func StateStores() map[string]StateStore {
 	return stateStores
 }
+
+// NewProcessorStateStore creates the state store with name, with keys in the namespace of the store in the
+// processor that is running.
+func NewProcessorStateStore(name string) (StateStore, error) {
+	s, err := NewStateStore(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewNamespacedStateStore(s, processorNamespace(name)), nil
+}
+
+// wrappedStateStore is implemented by state stores that wrap another state store.
+type wrappedStateStore interface {
+	unwrap() StateStore
+}
+
+// underlying returns the state store behind wrappers of s.
+func underlying(s StateStore) StateStore {
+	for {
+		w, ok := s.(wrappedStateStore)
+		if !ok {
+			return s
+		}
+		s = w.unwrap()
+	}
+}
+
+func isNamespaced(s StateStore) bool {
+	for {
+		if _, ok := s.(*NamespacedStateStore); ok {
+			return true
+		}
+		w, ok := s.(wrappedStateStore)
+		if !ok {
+			return false
+		}
+		s = w.unwrap()
+	}
+}
+
+// NewStateStore creates the state store with name, which is a local cache or a store in the global store config.
+func NewStateStore(name string) (StateStore, error) {
+	switch name {
+	case consts.StateStoreFreeCache:
+		return NewFreeCacheStateStore()
+	case consts.StateStoreBigCache:
+		return NewBigCacheStateStore()
+	}
+	if conf.GetRedisConfigByName(name) != nil {
+		return NewRedisStateStore(name)
+	}
+	if conf.GetMemcachedConfigByName(name) != nil {
+		return NewMemcachedStateStore(name)
+	}
+	return nil, fmt.Errorf("state store with name %s not found", name)
+}
+
+// ScanKeys returns up to limit keys with prefix in s, or all of them if limit is 0.
+func ScanKeys(ctx context.Context, s StateStore, prefix string, limit int) ([]string, error) {
+	keys := make([]string, 0)
+	var cursor uint64
+	for {
+		batch, next, err := s.Scan(ctx, prefix, cursor, consts.DefaultScanCount)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, batch...)
+		if limit > 0 && len(keys) >= limit {
+			return keys[:limit], nil
+		}
+		if next == 0 {
+			return keys, nil
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,70 @@
+package state
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestScanKeys(t *testing.T) {
+	ctx := context.Background()
+	s, _ := NewFreeCacheStateStore()
+	for i := 0; i < 250; i++ {
+		prefix := "a-"
+		if i%5 == 0 {
+			prefix = "b-"
+		}
+		s.Put(ctx, prefix+string(rune('A'+i%26))+string(rune('A'+i/26)), nil)
+	}
+	tests := []struct {
+		name    string
+		prefix  string
+		limit   int
+		wantLen int
+	}{
+		{name: "all", prefix: "", limit: 0, wantLen: 250},
+		{name: "prefix", prefix: "b-", limit: 0, wantLen: 50},
+		{name: "limit", prefix: "a-", limit: 120, wantLen: 120},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := ScanKeys(ctx, s, tt.prefix, tt.limit)
+			if err != nil {
+				t.Fatalf("ScanKeys() error = %v", err)
+			}
+			if len(keys) != tt.wantLen {
+				t.Errorf("ScanKeys() returns %v keys, want %v", len(keys), tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestEscapeGlob(t *testing.T) {
+	got := escapeGlob(`a*b?[c]\`)
+	want := `a\*b\?\[c\]\\`
+	if got != want {
+		t.Errorf("escapeGlob() = %v, want %v", got, want)
+	}
+}
+
+func TestIndexEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []indexEntry
+	}{
+		{name: "no expire", entries: []indexEntry{{key: "a"}}},
+		{name: "expire", entries: []indexEntry{{key: "a", expireAt: 100}, {key: "b"}}},
+		{name: "colon in key", entries: []indexEntry{{key: "a:b:c", expireAt: 100}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeIndexEntries(encodeIndexEntries(tt.entries))
+			if err != nil {
+				t.Fatalf("decodeIndexEntries() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.entries) {
+				t.Errorf("decodeIndexEntries() = %v, want %v", got, tt.entries)
+			}
+		})
+	}
+}
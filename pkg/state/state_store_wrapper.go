@@ -77,3 +77,144 @@ func (w *StateStoreWrapper) Delete(ctx context.Context, key string) error {
 func (w *StateStoreWrapper) Keys(ctx context.Context, limit int) ([]string, error) {
 	return w.s.Keys(ctx, limit)
 }
+
+func (w *StateStoreWrapper) Scan(ctx context.Context, prefix string, cursor uint64, count int) ([]string, uint64, error) {
+	startTime := time.Now()
+
+	keys, next, err := w.s.Scan(ctx, prefix, cursor, count)
+
+	w.emitCollectionMetrics("scan", startTime, err)
+	return keys, next, err
+}
+
+// Collection operations return ErrNotImplemented if the wrapped state store does not implement
+// CollectionStateStore. Use AsCollectionStateStore to check it.
+func (w *StateStoreWrapper) Append(ctx context.Context, key string, val []byte) error {
+	return w.AppendWithExpireTime(ctx, key, val, 0)
+}
+
+func (w *StateStoreWrapper) AppendWithExpireTime(ctx context.Context, key string, val []byte, expireSeconds int) error {
+	cs, ok := w.s.(CollectionStateStore)
+	if !ok {
+		return ErrNotImplemented
+	}
+	startTime := time.Now()
+
+	err := cs.AppendWithExpireTime(ctx, key, val, expireSeconds)
+
+	w.emitCollectionMetrics("append", startTime, err)
+	return err
+}
+
+func (w *StateStoreWrapper) SetAdd(ctx context.Context, key string, member []byte) error {
+	cs, ok := w.s.(CollectionStateStore)
+	if !ok {
+		return ErrNotImplemented
+	}
+	startTime := time.Now()
+
+	err := cs.SetAdd(ctx, key, member)
+
+	w.emitCollectionMetrics("set_add", startTime, err)
+	return err
+}
+
+func (w *StateStoreWrapper) SetRemove(ctx context.Context, key string, member []byte) error {
+	cs, ok := w.s.(CollectionStateStore)
+	if !ok {
+		return ErrNotImplemented
+	}
+	startTime := time.Now()
+
+	err := cs.SetRemove(ctx, key, member)
+
+	w.emitCollectionMetrics("set_remove", startTime, err)
+	return err
+}
+
+func (w *StateStoreWrapper) SetMembers(ctx context.Context, key string) ([][]byte, error) {
+	cs, ok := w.s.(CollectionStateStore)
+	if !ok {
+		return nil, ErrNotImplemented
+	}
+	startTime := time.Now()
+
+	res, err := cs.SetMembers(ctx, key)
+
+	w.emitCollectionMetrics("set_members", startTime, err)
+	return res, err
+}
+
+func (w *StateStoreWrapper) ListRange(ctx context.Context, key string, start int, stop int) ([][]byte, error) {
+	cs, ok := w.s.(CollectionStateStore)
+	if !ok {
+		return nil, ErrNotImplemented
+	}
+	startTime := time.Now()
+
+	res, err := cs.ListRange(ctx, key, start, stop)
+
+	w.emitCollectionMetrics("list_range", startTime, err)
+	return res, err
+}
+
+func (w *StateStoreWrapper) emitCollectionMetrics(op string, startTime time.Time, err error) {
+	elapsedTime := time.Since(startTime)
+	w.metricsClient.EmitHistogram(op+"_latency", "Latency of "+op+" operation in microseconds",
+		float64(elapsedTime.Microseconds()))
+	if err != nil {
+		w.metricsClient.EmitCounter(op+"_failure", "Number of "+op+" failures", 1)
+	}
+}
+
+func (w *StateStoreWrapper) MultiGet(ctx context.Context, keys []string) (map[string][]byte, error) {
+	bs, ok := w.s.(BatchStateStore)
+	if !ok {
+		return nil, ErrNotImplemented
+	}
+	startTime := time.Now()
+
+	res, err := bs.MultiGet(ctx, keys)
+
+	w.emitBatchMetrics("multi_get", startTime, len(keys), err)
+	if err == nil && len(res) < len(keys) {
+		w.metricsClient.EmitCounter("get_cache_miss", "Number of cache misses", float64(len(keys)-len(res)))
+	}
+	return res, err
+}
+
+func (w *StateStoreWrapper) MultiPut(ctx context.Context, kvs map[string][]byte) error {
+	bs, ok := w.s.(BatchStateStore)
+	if !ok {
+		return ErrNotImplemented
+	}
+	startTime := time.Now()
+
+	err := bs.MultiPut(ctx, kvs)
+
+	w.emitBatchMetrics("multi_put", startTime, len(kvs), err)
+	return err
+}
+
+func (w *StateStoreWrapper) MultiDelete(ctx context.Context, keys []string) error {
+	bs, ok := w.s.(BatchStateStore)
+	if !ok {
+		return ErrNotImplemented
+	}
+	startTime := time.Now()
+
+	err := bs.MultiDelete(ctx, keys)
+
+	w.emitBatchMetrics("multi_delete", startTime, len(keys), err)
+	return err
+}
+
+// emitBatchMetrics emits the metrics of a batch operation, and the number of keys in the batch.
+func (w *StateStoreWrapper) emitBatchMetrics(op string, startTime time.Time, size int, err error) {
+	w.emitCollectionMetrics(op, startTime, err)
+	w.metricsClient.EmitHistogram(op+"_batch_size", "Number of keys in a "+op+" batch", float64(size))
+}
+
+func (w *StateStoreWrapper) unwrap() StateStore {
+	return w.s
+}
@@ -0,0 +1,402 @@
+package state
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/TTraveller7/invokerlib/pkg/consts"
+)
+
+// Typed states keep values of a type in any state store, encoded by a codec. Lists and map keys are updated in
+// place if the state store supports collections. Otherwise, and for sorted states, a collection is kept in a single
+// value, and callers must serialize updates to the same state. Updates without an expire time clear the expire
+// time of the value they write, as Put does.
+
+// ValueState is a single value at key.
+type ValueState[T any] struct {
+	s     StateStore
+	key   string
+	codec Codec[T]
+}
+
+func NewValueState[T any](s StateStore, key string, codec Codec[T]) *ValueState[T] {
+	return &ValueState[T]{
+		s:     s,
+		key:   key,
+		codec: codec,
+	}
+}
+
+// Get returns the value, or consts.ErrStateStoreKeyNotExist if there is none.
+func (vs *ValueState[T]) Get(ctx context.Context) (T, error) {
+	var v T
+	b, err := vs.s.Get(ctx, vs.key)
+	if err != nil {
+		return v, err
+	}
+	v, err = vs.codec.Decode(b)
+	if err != nil {
+		return v, fmt.Errorf("decode value of %s failed: %v", vs.key, err)
+	}
+	return v, nil
+}
+
+func (vs *ValueState[T]) Put(ctx context.Context, v T) error {
+	return vs.PutWithExpireTime(ctx, v, 0)
+}
+
+func (vs *ValueState[T]) PutWithExpireTime(ctx context.Context, v T, expireSeconds int) error {
+	b, err := vs.codec.Encode(v)
+	if err != nil {
+		return fmt.Errorf("encode value of %s failed: %v", vs.key, err)
+	}
+	return putWithExpireTime(ctx, vs.s, vs.key, b, expireSeconds)
+}
+
+func (vs *ValueState[T]) Delete(ctx context.Context) error {
+	return vs.s.Delete(ctx, vs.key)
+}
+
+// ListState is a list of values at key.
+type ListState[T any] struct {
+	s     StateStore
+	cs    CollectionStateStore
+	key   string
+	codec Codec[T]
+}
+
+func NewListState[T any](s StateStore, key string, codec Codec[T]) *ListState[T] {
+	cs, _ := AsCollectionStateStore(s)
+	return &ListState[T]{
+		s:     s,
+		cs:    cs,
+		key:   key,
+		codec: codec,
+	}
+}
+
+func (ls *ListState[T]) Append(ctx context.Context, v T) error {
+	return ls.AppendWithExpireTime(ctx, v, 0)
+}
+
+// AppendWithExpireTime adds v to the end of the list, and the list expires expireSeconds after the last append.
+func (ls *ListState[T]) AppendWithExpireTime(ctx context.Context, v T, expireSeconds int) error {
+	b, err := ls.codec.Encode(v)
+	if err != nil {
+		return fmt.Errorf("encode element of %s failed: %v", ls.key, err)
+	}
+	if ls.cs != nil {
+		return ls.cs.AppendWithExpireTime(ctx, ls.key, b, expireSeconds)
+	}
+	return appendElement(ctx, ls.s, ls.key, b, expireSeconds)
+}
+
+// Range returns the values from start to stop, both inclusive. Negative indexes count from the end of the list.
+func (ls *ListState[T]) Range(ctx context.Context, start int, stop int) ([]T, error) {
+	var elements [][]byte
+	var err error
+	if ls.cs != nil {
+		elements, err = ls.cs.ListRange(ctx, ls.key, start, stop)
+	} else {
+		elements, err = readElements(ctx, ls.s, ls.key)
+		elements = listRange(elements, start, stop)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeAll(ls.codec, elements, ls.key)
+}
+
+// Get returns all values of the list.
+func (ls *ListState[T]) Get(ctx context.Context) ([]T, error) {
+	return ls.Range(ctx, 0, -1)
+}
+
+func (ls *ListState[T]) Clear(ctx context.Context) error {
+	return ls.s.Delete(ctx, ls.key)
+}
+
+// MapState is a map from keys to values under name. Each entry is a value of the state store, and the keys of the
+// map are kept in a set, so entries can be listed. Keys of the state store are prefixed by the length of name, so
+// keys of maps whose names share a prefix do not collide.
+type MapState[K comparable, V any] struct {
+	s          StateStore
+	cs         CollectionStateStore
+	name       string
+	keyCodec   Codec[K]
+	valueCodec Codec[V]
+}
+
+func NewMapState[K comparable, V any](s StateStore, name string, keyCodec Codec[K],
+	valueCodec Codec[V]) *MapState[K, V] {
+
+	cs, _ := AsCollectionStateStore(s)
+	return &MapState[K, V]{
+		s:          s,
+		cs:         cs,
+		name:       name,
+		keyCodec:   keyCodec,
+		valueCodec: valueCodec,
+	}
+}
+
+func (ms *MapState[K, V]) keysKey() string {
+	return fmt.Sprintf("%d:%s-keys", len(ms.name), ms.name)
+}
+
+func (ms *MapState[K, V]) entryKey(kb []byte) string {
+	return fmt.Sprintf("%d:%s-entry-%s", len(ms.name), ms.name, string(kb))
+}
+
+// Get returns the value of k, or consts.ErrStateStoreKeyNotExist if there is none.
+func (ms *MapState[K, V]) Get(ctx context.Context, k K) (V, error) {
+	var v V
+	kb, err := ms.keyCodec.Encode(k)
+	if err != nil {
+		return v, fmt.Errorf("encode key of %s failed: %v", ms.name, err)
+	}
+	b, err := ms.s.Get(ctx, ms.entryKey(kb))
+	if err != nil {
+		return v, err
+	}
+	v, err = ms.valueCodec.Decode(b)
+	if err != nil {
+		return v, fmt.Errorf("decode value of %s failed: %v", ms.name, err)
+	}
+	return v, nil
+}
+
+func (ms *MapState[K, V]) Put(ctx context.Context, k K, v V) error {
+	return ms.PutWithExpireTime(ctx, k, v, 0)
+}
+
+// PutWithExpireTime sets the value of k, which expires expireSeconds later. The key is listed by Keys until it is
+// deleted, but Entries skips it once the value expires.
+func (ms *MapState[K, V]) PutWithExpireTime(ctx context.Context, k K, v V, expireSeconds int) error {
+	kb, err := ms.keyCodec.Encode(k)
+	if err != nil {
+		return fmt.Errorf("encode key of %s failed: %v", ms.name, err)
+	}
+	b, err := ms.valueCodec.Encode(v)
+	if err != nil {
+		return fmt.Errorf("encode value of %s failed: %v", ms.name, err)
+	}
+	if err := putWithExpireTime(ctx, ms.s, ms.entryKey(kb), b, expireSeconds); err != nil {
+		return err
+	}
+	if ms.cs != nil {
+		return ms.cs.SetAdd(ctx, ms.keysKey(), kb)
+	}
+	return addMember(ctx, ms.s, ms.keysKey(), kb)
+}
+
+func (ms *MapState[K, V]) Delete(ctx context.Context, k K) error {
+	kb, err := ms.keyCodec.Encode(k)
+	if err != nil {
+		return fmt.Errorf("encode key of %s failed: %v", ms.name, err)
+	}
+	if err := ms.s.Delete(ctx, ms.entryKey(kb)); err != nil {
+		return err
+	}
+	if ms.cs != nil {
+		return ms.cs.SetRemove(ctx, ms.keysKey(), kb)
+	}
+	return removeMember(ctx, ms.s, ms.keysKey(), kb)
+}
+
+// Keys returns the keys of the map in no particular order.
+func (ms *MapState[K, V]) Keys(ctx context.Context) ([]K, error) {
+	members, err := ms.keyMembers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return decodeAll(ms.keyCodec, members, ms.name)
+}
+
+// Entries returns the entries of the map.
+func (ms *MapState[K, V]) Entries(ctx context.Context) (map[K]V, error) {
+	members, err := ms.keyMembers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[K]V, len(members))
+	for _, kb := range members {
+		k, err := ms.keyCodec.Decode(kb)
+		if err != nil {
+			return nil, fmt.Errorf("decode key of %s failed: %v", ms.name, err)
+		}
+		b, err := ms.s.Get(ctx, ms.entryKey(kb))
+		if err == consts.ErrStateStoreKeyNotExist {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		v, err := ms.valueCodec.Decode(b)
+		if err != nil {
+			return nil, fmt.Errorf("decode value of %s failed: %v", ms.name, err)
+		}
+		res[k] = v
+	}
+	return res, nil
+}
+
+// Clear deletes all entries of the map.
+func (ms *MapState[K, V]) Clear(ctx context.Context) error {
+	members, err := ms.keyMembers(ctx)
+	if err != nil {
+		return err
+	}
+	for _, kb := range members {
+		if err := ms.s.Delete(ctx, ms.entryKey(kb)); err != nil {
+			return err
+		}
+	}
+	return ms.s.Delete(ctx, ms.keysKey())
+}
+
+func (ms *MapState[K, V]) keyMembers(ctx context.Context) ([][]byte, error) {
+	if ms.cs != nil {
+		return ms.cs.SetMembers(ctx, ms.keysKey())
+	}
+	members, err := readElements(ctx, ms.s, ms.keysKey())
+	if err != nil {
+		return nil, err
+	}
+	return distinctElements(members), nil
+}
+
+// Scored is a value of a SortedState with its score.
+type Scored[T any] struct {
+	Score int64
+	Value T
+}
+
+// SortedState is a list of values at key ordered by score. Values with the same score are kept in the order they
+// are added.
+type SortedState[T any] struct {
+	s     StateStore
+	key   string
+	codec Codec[T]
+}
+
+func NewSortedState[T any](s StateStore, key string, codec Codec[T]) *SortedState[T] {
+	return &SortedState[T]{
+		s:     s,
+		key:   key,
+		codec: codec,
+	}
+}
+
+func (ss *SortedState[T]) Add(ctx context.Context, score int64, v T) error {
+	return ss.AddWithExpireTime(ctx, score, v, 0)
+}
+
+// AddWithExpireTime adds v with score, and the state expires expireSeconds after the update.
+func (ss *SortedState[T]) AddWithExpireTime(ctx context.Context, score int64, v T, expireSeconds int) error {
+	b, err := ss.codec.Encode(v)
+	if err != nil {
+		return fmt.Errorf("encode element of %s failed: %v", ss.key, err)
+	}
+	elements, err := ss.readScored(ctx)
+	if err != nil {
+		return err
+	}
+	i := sort.Search(len(elements), func(i int) bool {
+		return scoreOf(elements[i]) > score
+	})
+	elements = append(elements, nil)
+	copy(elements[i+1:], elements[i:])
+	elements[i] = encodeScored(score, b)
+	return putWithExpireTime(ctx, ss.s, ss.key, encodeElements(elements), expireSeconds)
+}
+
+// Range returns the values with scores from min to max, both inclusive, in order.
+func (ss *SortedState[T]) Range(ctx context.Context, min int64, max int64) ([]Scored[T], error) {
+	elements, err := ss.readScored(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Scored[T], 0)
+	for _, e := range elements {
+		score := scoreOf(e)
+		if score < min || score > max {
+			continue
+		}
+		v, err := ss.codec.Decode(e[8:])
+		if err != nil {
+			return nil, fmt.Errorf("decode element of %s failed: %v", ss.key, err)
+		}
+		res = append(res, Scored[T]{Score: score, Value: v})
+	}
+	return res, nil
+}
+
+// RemoveRange removes the values with scores from min to max, both inclusive.
+func (ss *SortedState[T]) RemoveRange(ctx context.Context, min int64, max int64) error {
+	elements, err := ss.readScored(ctx)
+	if err != nil {
+		return err
+	}
+	kept := make([][]byte, 0, len(elements))
+	for _, e := range elements {
+		if score := scoreOf(e); score < min || score > max {
+			kept = append(kept, e)
+		}
+	}
+	if len(kept) == len(elements) {
+		return nil
+	}
+	return ss.s.Put(ctx, ss.key, encodeElements(kept))
+}
+
+func (ss *SortedState[T]) Clear(ctx context.Context) error {
+	return ss.s.Delete(ctx, ss.key)
+}
+
+// readScored returns the elements of the state, which are prefixed by their scores.
+func (ss *SortedState[T]) readScored(ctx context.Context) ([][]byte, error) {
+	elements, err := readElements(ctx, ss.s, ss.key)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range elements {
+		if len(e) < 8 {
+			return nil, fmt.Errorf("malformed sorted element of %s", ss.key)
+		}
+	}
+	return elements, nil
+}
+
+// encodeScored prefixes b with score in 8 bytes.
+func encodeScored(score int64, b []byte) []byte {
+	res := make([]byte, 8+len(b))
+	binary.BigEndian.PutUint64(res, uint64(score))
+	copy(res[8:], b)
+	return res
+}
+
+func scoreOf(e []byte) int64 {
+	return int64(binary.BigEndian.Uint64(e))
+}
+
+// putWithExpireTime puts val at key, which does not expire if expireSeconds is 0.
+func putWithExpireTime(ctx context.Context, s StateStore, key string, val []byte, expireSeconds int) error {
+	if expireSeconds == 0 {
+		return s.Put(ctx, key, val)
+	}
+	return s.PutWithExpireTime(ctx, key, val, expireSeconds)
+}
+
+func decodeAll[T any](codec Codec[T], elements [][]byte, key string) ([]T, error) {
+	res := make([]T, 0, len(elements))
+	for _, e := range elements {
+		v, err := codec.Decode(e)
+		if err != nil {
+			return nil, fmt.Errorf("decode element of %s failed: %v", key, err)
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
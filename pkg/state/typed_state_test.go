@@ -0,0 +1,313 @@
+package state
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/TTraveller7/invokerlib/pkg/consts"
+)
+
+func TestSortedState(t *testing.T) {
+	ctx := context.Background()
+	s, _ := NewFreeCacheStateStore()
+	ss := NewSortedState[string](s, "sorted", JsonCodec[string]{})
+	for _, sv := range []Scored[string]{{5, "e"}, {-1, "a"}, {3, "c"}, {3, "d"}, {10, "f"}} {
+		if err := ss.Add(ctx, sv.Score, sv.Value); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+	if err := ss.RemoveRange(ctx, 6, 20); err != nil {
+		t.Fatalf("RemoveRange() error = %v", err)
+	}
+
+	got, err := ss.Range(ctx, -5, 5)
+	if err != nil {
+		t.Fatalf("Range() error = %v", err)
+	}
+	want := []Scored[string]{{-1, "a"}, {3, "c"}, {3, "d"}, {5, "e"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Range() = %v, want %v", got, want)
+	}
+}
+
+// plainStateStore hides the collections of a state store, so typed states keep collections in a single value.
+type plainStateStore struct {
+	StateStore
+}
+
+func TestValueState(t *testing.T) {
+	ctx := context.Background()
+	s, _ := NewFreeCacheStateStore()
+	type point struct {
+		X int
+		Y int
+	}
+	tests := []struct {
+		name    string
+		puts    []point
+		delete  bool
+		want    point
+		wantErr error
+	}{
+		{name: "put", puts: []point{{1, 2}}, want: point{1, 2}},
+		{name: "overwrite", puts: []point{{1, 2}, {3, 4}}, want: point{3, 4}},
+		{name: "delete", puts: []point{{1, 2}}, delete: true, wantErr: consts.ErrStateStoreKeyNotExist},
+		{name: "missing", wantErr: consts.ErrStateStoreKeyNotExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vs := NewValueState[point](s, "value-"+tt.name, JsonCodec[point]{})
+			for _, p := range tt.puts {
+				if err := vs.Put(ctx, p); err != nil {
+					t.Fatalf("Put() error = %v", err)
+				}
+			}
+			if tt.delete {
+				if err := vs.Delete(ctx); err != nil {
+					t.Fatalf("Delete() error = %v", err)
+				}
+			}
+			got, err := vs.Get(ctx)
+			if err != tt.wantErr {
+				t.Fatalf("Get() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Get() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListState(t *testing.T) {
+	ctx := context.Background()
+	s, _ := NewFreeCacheStateStore()
+	tests := []struct {
+		name  string
+		s     StateStore
+		start int
+		stop  int
+		want  []int
+	}{
+		{name: "native all", s: s, start: 0, stop: -1, want: []int{1, 2, 3, 4}},
+		{name: "native range", s: s, start: 1, stop: -2, want: []int{2, 3}},
+		{name: "native out of range", s: s, start: 5, stop: 10, want: []int{}},
+		{name: "single value all", s: &plainStateStore{s}, start: 0, stop: -1, want: []int{1, 2, 3, 4}},
+		{name: "single value range", s: &plainStateStore{s}, start: -2, stop: 10, want: []int{3, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ls := NewListState[int](tt.s, "list-"+tt.name, GobCodec[int]{})
+			if _, isNative := tt.s.(*plainStateStore); (ls.cs == nil) != isNative {
+				t.Fatalf("ListState uses native collections = %v, want %v", ls.cs != nil, !isNative)
+			}
+			for _, v := range []int{1, 2, 3, 4} {
+				if err := ls.Append(ctx, v); err != nil {
+					t.Fatalf("Append() error = %v", err)
+				}
+			}
+			got, err := ls.Range(ctx, tt.start, tt.stop)
+			if err != nil {
+				t.Fatalf("Range() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Range() = %v, want %v", got, tt.want)
+			}
+			if err := ls.Clear(ctx); err != nil {
+				t.Fatalf("Clear() error = %v", err)
+			}
+			if got, err := ls.Get(ctx); err != nil || len(got) != 0 {
+				t.Errorf("Get() after Clear() = %v, %v, want empty", got, err)
+			}
+		})
+	}
+}
+
+func TestMapState(t *testing.T) {
+	ctx := context.Background()
+	s, _ := NewFreeCacheStateStore()
+	type op struct {
+		put    bool
+		delete bool
+		clear  bool
+		k      string
+		v      int
+	}
+	tests := []struct {
+		name        string
+		ops         []op
+		wantKeys    []string
+		wantEntries map[string]int
+	}{
+		{
+			name:        "put",
+			ops:         []op{{put: true, k: "a", v: 1}, {put: true, k: "b", v: 2}},
+			wantKeys:    []string{"a", "b"},
+			wantEntries: map[string]int{"a": 1, "b": 2},
+		},
+		{
+			name:        "overwrite",
+			ops:         []op{{put: true, k: "a", v: 1}, {put: true, k: "a", v: 3}},
+			wantKeys:    []string{"a"},
+			wantEntries: map[string]int{"a": 3},
+		},
+		{
+			name:        "delete",
+			ops:         []op{{put: true, k: "a", v: 1}, {put: true, k: "b", v: 2}, {delete: true, k: "a"}},
+			wantKeys:    []string{"b"},
+			wantEntries: map[string]int{"b": 2},
+		},
+		{
+			name:        "clear",
+			ops:         []op{{put: true, k: "a", v: 1}, {put: true, k: "b", v: 2}, {clear: true}},
+			wantKeys:    []string{},
+			wantEntries: map[string]int{},
+		},
+	}
+	for _, store := range []struct {
+		name string
+		s    StateStore
+	}{{"native", s}, {"single value", &plainStateStore{s}}} {
+		for _, tt := range tests {
+			t.Run(store.name+" "+tt.name, func(t *testing.T) {
+				ms := NewMapState[string, int](store.s, store.name+"-"+tt.name, StringCodec{}, SonicCodec[int]{})
+				for _, o := range tt.ops {
+					var err error
+					switch {
+					case o.put:
+						err = ms.Put(ctx, o.k, o.v)
+					case o.delete:
+						err = ms.Delete(ctx, o.k)
+					case o.clear:
+						err = ms.Clear(ctx)
+					}
+					if err != nil {
+						t.Fatalf("update map failed: %v", err)
+					}
+				}
+				keys, err := ms.Keys(ctx)
+				if err != nil {
+					t.Fatalf("Keys() error = %v", err)
+				}
+				sort.Strings(keys)
+				if !reflect.DeepEqual(keys, tt.wantKeys) {
+					t.Errorf("Keys() = %v, want %v", keys, tt.wantKeys)
+				}
+				entries, err := ms.Entries(ctx)
+				if err != nil {
+					t.Fatalf("Entries() error = %v", err)
+				}
+				if !reflect.DeepEqual(entries, tt.wantEntries) {
+					t.Errorf("Entries() = %v, want %v", entries, tt.wantEntries)
+				}
+				for k, v := range tt.wantEntries {
+					if got, err := ms.Get(ctx, k); err != nil || got != v {
+						t.Errorf("Get(%s) = %v, %v, want %v", k, got, err, v)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestMapState_Expired(t *testing.T) {
+	ctx := context.Background()
+	s, _ := NewFreeCacheStateStore()
+	ms := NewMapState[string, string](s, "expiring", StringCodec{}, JsonCodec[string]{})
+	if err := ms.PutWithExpireTime(ctx, "a", "expires", 1); err != nil {
+		t.Fatalf("PutWithExpireTime() error = %v", err)
+	}
+	if err := ms.Put(ctx, "b", "stays"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	time.Sleep(2 * time.Second)
+
+	keys, err := ms.Keys(ctx)
+	if err != nil {
+		t.Fatalf("Keys() error = %v", err)
+	}
+	sort.Strings(keys)
+	if want := []string{"a", "b"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Keys() = %v, want %v", keys, want)
+	}
+	entries, err := ms.Entries(ctx)
+	if err != nil {
+		t.Fatalf("Entries() error = %v", err)
+	}
+	if want := map[string]string{"b": "stays"}; !reflect.DeepEqual(entries, want) {
+		t.Errorf("Entries() = %v, want %v", entries, want)
+	}
+}
+
+func TestMapState_NamesSharingPrefix(t *testing.T) {
+	ctx := context.Background()
+	s, _ := NewFreeCacheStateStore()
+	foo := NewMapState[string, string](s, "foo", StringCodec{}, StringCodec{})
+	fooEntry := NewMapState[string, string](s, "foo-entry-k", StringCodec{}, StringCodec{})
+	if err := foo.Put(ctx, "k-keys", "v"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if err := fooEntry.Put(ctx, "x", "y"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if got, err := foo.Get(ctx, "k-keys"); err != nil || got != "v" {
+		t.Errorf("Get() = %v, %v, want v", got, err)
+	}
+	keys, err := fooEntry.Keys(ctx)
+	if err != nil {
+		t.Fatalf("Keys() error = %v", err)
+	}
+	if want := []string{"x"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Keys() = %v, want %v", keys, want)
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	type event struct {
+		Name  string
+		Count int
+		Tags  []string
+	}
+	e := event{Name: "click", Count: 3, Tags: []string{"a", "b"}}
+	tests := []struct {
+		name      string
+		roundTrip func() (any, error)
+		want      any
+	}{
+		{name: "json", roundTrip: func() (any, error) { return roundTrip[event](JsonCodec[event]{}, e) }, want: e},
+		{name: "sonic", roundTrip: func() (any, error) { return roundTrip[event](SonicCodec[event]{}, e) }, want: e},
+		{name: "gob", roundTrip: func() (any, error) { return roundTrip[event](GobCodec[event]{}, e) }, want: e},
+		{
+			name:      "raw",
+			roundTrip: func() (any, error) { return roundTrip[[]byte](RawCodec{}, []byte{0, 1, 2}) },
+			want:      []byte{0, 1, 2},
+		},
+		{
+			name:      "string",
+			roundTrip: func() (any, error) { return roundTrip[string](StringCodec{}, "key") },
+			want:      "key",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.roundTrip()
+			if err != nil {
+				t.Fatalf("round trip error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("round trip = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func roundTrip[T any](codec Codec[T], v T) (T, error) {
+	b, err := codec.Encode(v)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return codec.Decode(b)
+}
@@ -0,0 +1,41 @@
+package utils
+
+import "time"
+
+// CatchUp tells when a partition consumer has consumed the records in the partition before an end offset. Records
+// at the end of a partition may be transaction markers or records of aborted transactions, which are never
+// delivered, so the partition is also caught up when no record is delivered for idle. The idle time is counted
+// from the last delivered record, since a slow first fetch does not mean there is nothing left to deliver. If no
+// record is delivered at all, the partition is caught up after firstRecordTimeout.
+type CatchUp struct {
+	end                int64
+	idle               time.Duration
+	firstRecordTimeout time.Duration
+	started            time.Time
+	lastRecord         time.Time
+}
+
+func NewCatchUp(end int64, idle time.Duration, firstRecordTimeout time.Duration) *CatchUp {
+	return &CatchUp{
+		end:                end,
+		idle:               idle,
+		firstRecordTimeout: firstRecordTimeout,
+		started:            time.Now(),
+	}
+}
+
+// Consumed is called with the offset of each delivered record. It returns true if the record is the last record
+// before the end offset.
+func (c *CatchUp) Consumed(offset int64) bool {
+	c.lastRecord = time.Now()
+	return offset >= c.end-1
+}
+
+// Idle returns true if the partition is caught up without delivering the record before the end offset. It is
+// called periodically.
+func (c *CatchUp) Idle() bool {
+	if c.lastRecord.IsZero() {
+		return time.Since(c.started) >= c.firstRecordTimeout
+	}
+	return time.Since(c.lastRecord) >= c.idle
+}
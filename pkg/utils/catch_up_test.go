@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCatchUp(t *testing.T) {
+	c := NewCatchUp(10, 20*time.Millisecond, time.Hour)
+
+	// a slow first fetch is not idle
+	time.Sleep(30 * time.Millisecond)
+	if c.Idle() {
+		t.Errorf("Idle() = true before the first record")
+	}
+
+	if c.Consumed(5) {
+		t.Errorf("Consumed(5) = true, want false")
+	}
+	if c.Idle() {
+		t.Errorf("Idle() = true right after a record")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if !c.Idle() {
+		t.Errorf("Idle() = false after idle time")
+	}
+	if !c.Consumed(9) {
+		t.Errorf("Consumed(9) = false, want true")
+	}
+}
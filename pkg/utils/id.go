@@ -1,7 +1,6 @@
 package utils
 
 import (
-	"context"
 	"encoding/base64"
 	"fmt"
 
@@ -18,15 +17,3 @@ func NewWorkerId(workerIndex int, processorName string, topicName string) string
 func NewRecordId() fmt.Stringer {
 	return uuid.New()
 }
-
-func BatchId(ctx context.Context, watermark int64) string {
-	workerId, success := WorkerId(ctx)
-	if !success {
-		panic("context does not have worker id")
-	}
-	return BatchIdFromWorkerId(workerId, watermark)
-}
-
-func BatchIdFromWorkerId(workerId string, watermark int64) string {
-	return fmt.Sprintf("%s-%v", workerId, watermark-1288834974)
-}
@@ -1,6 +1,10 @@
 package utils
 
-import "testing"
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
 
 func TestNewWorkerId(t *testing.T) {
 	type args struct {
@@ -9,9 +13,9 @@ func TestNewWorkerId(t *testing.T) {
 		topicName     string
 	}
 	tests := []struct {
-		name string
-		args args
-		want string
+		name       string
+		args       args
+		wantPrefix string
 	}{
 		{
 			name: "test",
@@ -20,13 +24,22 @@ func TestNewWorkerId(t *testing.T) {
 				processorName: "splitter",
 				topicName:     "word_count_source",
 			},
-			want: "wut",
+			wantPrefix: "w_splitter_0_word_count_source_",
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := NewWorkerId(tt.args.workerIndex, tt.args.processorName, tt.args.topicName); got != tt.want {
-				t.Errorf("NewWorkerId() = %v, want %v", got, tt.want)
+			got := NewWorkerId(tt.args.workerIndex, tt.args.processorName, tt.args.topicName)
+			decoded, err := base64.StdEncoding.DecodeString(got)
+			if err != nil {
+				t.Fatalf("NewWorkerId() = %v, not base64: %v", got, err)
+			}
+			if !strings.HasPrefix(string(decoded), tt.wantPrefix) {
+				t.Errorf("NewWorkerId() decodes to %s, want prefix %s", decoded, tt.wantPrefix)
+			}
+			// replicas of a processor have workers with the same index
+			if other := NewWorkerId(tt.args.workerIndex, tt.args.processorName, tt.args.topicName); other == got {
+				t.Errorf("NewWorkerId() = %v twice, want unique ids", got)
 			}
 		})
 	}
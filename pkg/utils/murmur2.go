@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"encoding/binary"
+	"hash"
+)
+
+const (
+	murmur2Seed = 0x9747b28c
+	murmur2M    = 0x5bd1e995
+	murmur2R    = 24
+)
+
+// murmur2 is the 32-bit murmur2 hash used by the default partitioner of the Java Kafka client.
+type murmur2 struct {
+	data []byte
+}
+
+// NewMurmur2 returns a hash.Hash32 computing the murmur2 hash of all written bytes.
+func NewMurmur2() hash.Hash32 {
+	return &murmur2{}
+}
+
+func (m *murmur2) Write(p []byte) (int, error) {
+	m.data = append(m.data, p...)
+	return len(p), nil
+}
+
+func (m *murmur2) Sum(b []byte) []byte {
+	return binary.BigEndian.AppendUint32(b, m.Sum32())
+}
+
+func (m *murmur2) Reset() {
+	m.data = m.data[:0]
+}
+
+func (m *murmur2) Size() int {
+	return 4
+}
+
+func (m *murmur2) BlockSize() int {
+	return 4
+}
+
+func (m *murmur2) Sum32() uint32 {
+	data := m.data
+	length := len(data)
+	h := uint32(murmur2Seed) ^ uint32(length)
+
+	for len(data) >= 4 {
+		k := binary.LittleEndian.Uint32(data)
+		k *= murmur2M
+		k ^= k >> murmur2R
+		k *= murmur2M
+		h *= murmur2M
+		h ^= k
+		data = data[4:]
+	}
+
+	switch len(data) {
+	case 3:
+		h ^= uint32(data[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[0])
+		h *= murmur2M
+	}
+
+	h ^= h >> 13
+	h *= murmur2M
+	h ^= h >> 15
+	return h
+}
@@ -0,0 +1,52 @@
+package utils
+
+import "testing"
+
+func TestMurmur2(t *testing.T) {
+	// expected values are from the Java Kafka client
+	tests := []struct {
+		name string
+		data string
+		want int32
+	}{
+		{
+			name: "two bytes",
+			data: "21",
+			want: -973932308,
+		},
+		{
+			name: "three bytes",
+			data: "abc",
+			want: 479470107,
+		},
+		{
+			name: "six bytes",
+			data: "foobar",
+			want: -790332482,
+		},
+		{
+			name: "long string",
+			data: "a-little-bit-long-string",
+			want: -985981536,
+		},
+		{
+			name: "longer string",
+			data: "a-little-bit-longer-string",
+			want: -1486304829,
+		},
+		{
+			name: "random string",
+			data: "lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8",
+			want: -58897971,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewMurmur2()
+			h.Write([]byte(tt.data))
+			if got := int32(h.Sum32()); got != tt.want {
+				t.Errorf("Sum32() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}